@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/dbpool"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/logger"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/maintenance"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/retry"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -33,7 +40,13 @@ func ProvidePgxPool() any {
 			return nil, fmt.Errorf("invalid database url")
 		}
 
-		err := sql.Migrate(logger, databaseURL)
+		// the database may come up after the cleaner, so wait for it
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err := retry.Do(ctx, cfg.Database.Retry, logger, "migrate database", func(ctx context.Context) error {
+			return migrate(cfg, logger)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to migrate database: %w", err)
 		}
@@ -43,26 +56,30 @@ func ProvidePgxPool() any {
 			return nil, fmt.Errorf("failed to parse database url")
 		}
 
-		// handle max conns
-		{
-			var maxConns int32
-			if cfg.Database.MaxConns == 0 {
-				maxConns = 20
-			} else {
-				maxConns = int32(cfg.Database.MaxConns)
-			}
+		// handle pool size, lifetimes and timeouts
+		cfg.Database.Apply(pgxconfig)
 
-			pgxconfig.MaxConns = maxConns
-		}
+		// handle schema
+		sql.SetSearchPath(pgxconfig.ConnConfig, cfg.Database.Schema)
 
-		// handle timeout duration
-		connectTimeoutDuration := time.Second * 10
-		pgxconfig.ConnConfig.ConnectTimeout = connectTimeoutDuration
+		var pool *pgxpool.Pool
+		err = retry.Do(ctx, cfg.Database.Retry, logger, "connect pool", func(ctx context.Context) error {
+			ctx, cancelFn := context.WithTimeout(ctx, pgxconfig.ConnConfig.ConnectTimeout)
+			defer cancelFn()
 
-		ctx, cancelFn := context.WithTimeout(context.Background(), connectTimeoutDuration)
-		defer cancelFn()
+			var err error
+			pool, err = pgxpool.NewWithConfig(ctx, pgxconfig)
+			if err != nil {
+				return err
+			}
 
-		pool, err := pgxpool.NewWithConfig(ctx, pgxconfig)
+			if err := pool.Ping(ctx); err != nil {
+				pool.Close()
+				return err
+			}
+
+			return nil
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to the postgres database: %w", err)
 		}
@@ -80,34 +97,177 @@ func ProvidePgxPool() any {
 	}
 }
 
-// clean purges the old roles from the database
-func clean(ctx context.Context, pool *pgxpool.Pool, maxAge time.Duration) (int64, error) {
+// migrate migrates the database. A database migrated by a newer binary is a
+// permanent error, as waiting will not fix it.
+func migrate(cfg Config, logger *slog.Logger) error {
+	migrationURL, opts := migrationTarget(cfg, logger)
+
+	err := sql.Migrate(logger, migrationURL, opts...)
+	if errors.Is(err, sql.ErrSchemaTooNew) {
+		return retry.Permanent(err)
+	}
+
+	return err
+}
+
+// migrationTarget returns the url and options to migrate the database with,
+// using the migration url if one is set.
+func migrationTarget(cfg Config, logger *slog.Logger) (string, []sql.MigrateOption) {
+	opts := []sql.MigrateOption{
+		sql.WithSchema(cfg.Database.Schema),
+		sql.WithLockTimeout(cfg.Database.MigrationLockTimeout),
+	}
+
+	migrationURL := cfg.Database.MigrationURL
+	if migrationURL == "" {
+		migrationURL = cfg.Database.URL
+
+		if cfg.Database.PgBouncer {
+			// the session level migration lock is not reliable when the
+			// session may move between server connections
+			logger.Warn("migrating through pgbouncer, set database.migration-url to connect directly")
+			opts = append(opts, sql.WithQueryExecMode(dbpool.PgBouncerQueryExecMode))
+		}
+	}
+
+	return migrationURL, opts
+}
+
+// checkRowLevelSecurity fails if the tenant isolation policies are enabled
+// and apply to the role the cleaner connects as, as the cleaner would then see
+// and delete no spans at all.
+func checkRowLevelSecurity(ctx context.Context, pool *pgxpool.Pool) error {
 	q := sql.New(pool)
-	result, err := q.CleanSpans(ctx, pgtype.Timestamp{Time: time.Now().Add(-1 * maxAge), Valid: true})
+
+	enabled, err := q.GetRowLevelSecurity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get row level security state: %w", err)
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	role, err := q.GetCurrentRole(ctx)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("failed to get current role: %w", err)
 	}
 
-	return result, nil
+	if !role.BypassRls {
+		return fmt.Errorf("row level security is enabled but role %q does not bypass it, so no spans would be cleaned; connect as a role with BYPASSRLS", role.Name)
+	}
+
+	return nil
+}
+
+// clean purges the old roles from the database. Tenants with their own
+// retention are cleaned according to it, every other tenant according to
+// maxAge.
+func clean(ctx context.Context, pool *pgxpool.Pool, maxAge time.Duration, tenants []TenantRetention) (int64, error) {
+	q := sql.New(pool)
+	now := time.Now()
+
+	var total int64
+	excluded := make([]string, 0, len(tenants))
+	for _, tenant := range tenants {
+		result, err := q.CleanTenantSpans(ctx, sql.CleanTenantSpansParams{
+			Tenant:      tenant.Name,
+			PruneBefore: pgtype.Timestamp{Time: now.Add(-1 * tenant.MaxSpanAge), Valid: true},
+		})
+		if err != nil {
+			return total, fmt.Errorf("failed to clean tenant %s: %w", tenant.Name, err)
+		}
+
+		total += result
+		excluded = append(excluded, tenant.Name)
+	}
+
+	result, err := q.CleanSpans(ctx, sql.CleanSpansParams{
+		PruneBefore:     pgtype.Timestamp{Time: now.Add(-1 * maxAge), Valid: true},
+		ExcludedTenants: excluded,
+	})
+	if err != nil {
+		return total, err
+	}
+
+	return total + result, nil
+}
+
+// maintain vacuums and reindexes the database if configured to do so
+func maintain(ctx context.Context, cfg Config, pool *pgxpool.Pool, logger *slog.Logger) error {
+	m := maintenance.New(sql.New(pool), logger.With("component", "maintenance"))
+
+	if cfg.Maintenance.Vacuum {
+		if err := m.Vacuum(ctx); err != nil {
+			return err
+		}
+
+		logger.Info("successfully vacuumed database")
+	}
+
+	if cfg.Maintenance.Reindex {
+		if err := m.Reindex(ctx); err != nil {
+			return err
+		}
+
+		logger.Info("successfully reindexed database")
+	}
+
+	return nil
+}
+
+// TenantRetention overrides max-span-age for a single tenant.
+type TenantRetention struct {
+	Name       string        `mapstructure:"name"`
+	MaxSpanAge time.Duration `mapstructure:"max-span-age"`
 }
 
 type Config struct {
 	Database struct {
-		URL      string `mapstructure:"url"`
-		MaxConns int    `mapstructure:"max-conns"`
+		URL                  string        `mapstructure:"url"`
+		MigrationURL         string        `mapstructure:"migration-url"`
+		MigrationLockTimeout time.Duration `mapstructure:"migration-lock-timeout"`
+		Schema               string        `mapstructure:"schema"`
+		Retry                retry.Config  `mapstructure:"retry"`
+		dbpool.Config        `mapstructure:",squash"`
 	} `mapstructure:"database"`
 
 	LogLevel string `mapstructure:"log-level"`
 
 	MaxSpanAge time.Duration `mapstructure:"max-span-age"`
+
+	// Tenants is only read from the config file, as flags cannot express it.
+	Tenants []TenantRetention `mapstructure:"tenants"`
+
+	Maintenance struct {
+		Vacuum  bool `mapstructure:"vacuum"`
+		Reindex bool `mapstructure:"reindex"`
+	} `mapstructure:"maintenance"`
 }
 
 func ProvideConfig() func() (Config, error) {
 	return func() (Config, error) {
 		pflag.String("database.url", "", "the postgres connection url to use to connect to the database")
-		pflag.Int("database.max-conns", 20, "Max number of database connections of which the plugin will try to maintain at any given time")
+		pflag.Int("database.max-conns", dbpool.DefaultMaxConns, "Max number of database connections of which the cleaner will try to maintain at any given time")
+		pflag.Int("database.min-conns", 0, "Min number of database connections kept open")
+		pflag.Duration("database.connect-timeout", dbpool.DefaultConnectTimeout, "Timeout for establishing a database connection")
+		pflag.Duration("database.max-conn-lifetime", time.Hour, "Duration after which a connection is closed and replaced")
+		pflag.Duration("database.max-conn-idle-time", time.Minute*30, "Duration after which an idle connection is closed")
+		pflag.Duration("database.health-check-period", time.Minute, "How often idle connections are checked")
+		pflag.Duration("database.statement-timeout", 0, "The postgres statement_timeout of the connections (0 uses the server default)")
+		pflag.Duration("database.lock-timeout", 0, "The postgres lock_timeout of the connections (0 uses the server default)")
+		pflag.String("database.application-name", "jaeger-postgresql-cleaner", "The postgres application_name of the connections")
+		pflag.Bool("database.pgbouncer", false, "Whether the connections go through PgBouncer in transaction pooling mode, which rules out named prepared statements. PgBouncer rejects the schema, statement-timeout and lock-timeout startup parameters unless they are in its ignore_startup_parameters, in which case they must be set on the database role instead")
+		pflag.String("database.migration-url", "", "the postgres connection url to run migrations over, e.g. to bypass PgBouncer (defaults to database.url)")
+		pflag.Duration("database.retry.initial-interval", retry.DefaultInitialInterval, "How long to wait before retrying to connect to or migrate the database the first time; the wait doubles with every attempt")
+		pflag.Duration("database.retry.max-interval", retry.DefaultMaxInterval, "The longest wait between two attempts to connect to or migrate the database")
+		pflag.Duration("database.retry.max-elapsed-time", time.Minute*5, "How long to keep retrying to connect to or migrate the database before exiting (0 retries forever)")
+		pflag.Duration("database.migration-lock-timeout", time.Minute*5, "How long to wait for another replica or the cleaner to finish migrating the database (0 waits indefinitely)")
+		pflag.String("database.schema", "", "the schema to store the tables in, created if it does not exist; lets several deployments share one database. Defaults to the search_path of the database user")
 		pflag.String("log-level", "warn", "Minimal allowed log level")
 		pflag.Duration("max-span-age", time.Hour*24, "Maximum age of a span before it will be cleaned")
+		pflag.Bool("maintenance.vacuum", false, "Whether to run VACUUM (ANALYZE) on the spans, services and operations tables after cleaning")
+		pflag.Bool("maintenance.reindex", false, "Whether to run REINDEX CONCURRENTLY on the spans, services and operations tables after cleaning")
 
 		v := viper.New()
 		v.SetEnvPrefix("JAEGER_POSTGRESQL")
@@ -153,7 +313,13 @@ func main() {
 				ctx, cancelFn := context.WithTimeout(ctx, time.Minute)
 				defer cancelFn()
 
-				count, err := clean(ctx, pool, cfg.MaxSpanAge)
+				if err := checkRowLevelSecurity(ctx, pool); err != nil {
+					logger.Error("failed to clean database", "err", err)
+					stopper.Shutdown(fx.ExitCode(1))
+					return
+				}
+
+				count, err := clean(ctx, pool, cfg.MaxSpanAge, cfg.Tenants)
 				if err != nil {
 					logger.Error("failed to clean database", "err", err)
 					stopper.Shutdown(fx.ExitCode(1))
@@ -161,6 +327,14 @@ func main() {
 				}
 
 				logger.Info("successfully cleaned database", "spans", count)
+
+				err = maintain(context.Background(), cfg, pool, logger)
+				if err != nil {
+					logger.Error("failed to maintain database", "err", err)
+					stopper.Shutdown(fx.ExitCode(1))
+					return
+				}
+
 				stopper.Shutdown(fx.ExitCode(0))
 			}(context.Background())
 			return nil
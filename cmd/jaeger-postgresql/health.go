@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/store"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// readinessCheck is a named check of whether the plugin can serve.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a readinessCheck.
+type checkResult struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness decides whether the plugin is ready to serve. It is not ready
+// until the database is connected and the servers are started.
+type Readiness struct {
+	checks atomic.Pointer[[]readinessCheck]
+}
+
+var errNotReady = errors.New("waiting for the database and the servers to start")
+
+// Ready marks the plugin as ready, with the checks deciding whether it still
+// is.
+func (r *Readiness) Ready(checks ...readinessCheck) {
+	r.checks.Store(&checks)
+}
+
+// Check runs the checks, returning their results and an error if any of them
+// failed.
+func (r *Readiness) Check(ctx context.Context) ([]checkResult, error) {
+	checks := r.checks.Load()
+	if checks == nil {
+		return []checkResult{{Name: "startup", Error: errNotReady.Error()}}, errNotReady
+	}
+
+	results := make([]checkResult, 0, len(*checks))
+	var errs []error
+	for _, c := range *checks {
+		result := checkResult{Name: c.name}
+		if err := c.check(ctx); err != nil {
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// ProvideReadiness provides the readiness of the plugin.
+func ProvideReadiness() any {
+	return func() *Readiness {
+		return &Readiness{}
+	}
+}
+
+type namedPool struct {
+	name string
+	pool *pgxpool.Pool
+}
+
+// readinessChecks returns the checks of the database behind the pools, of the
+// writer, which is nil when not writing, and of the canary, which is nil when
+// disabled.
+func readinessChecks(cfg Config, pools Pools, writer *store.Writer, canary *store.Canary) []readinessCheck {
+	// there is always at least one pool, and the schema version is read from
+	// the primary when there is a write pool
+	var all []namedPool
+	if pools.Write != nil {
+		all = append(all, namedPool{name: "write", pool: pools.Write})
+	}
+	if pools.Read != nil {
+		all = append(all, namedPool{name: "read", pool: pools.Read})
+	}
+
+	checks := []readinessCheck{
+		{
+			name: "database",
+			check: func(ctx context.Context) error {
+				for _, p := range all {
+					if err := p.pool.Ping(ctx); err != nil {
+						return fmt.Errorf("failed to ping %s pool: %w", p.name, err)
+					}
+				}
+
+				return nil
+			},
+		},
+		{
+			// a read-only replica may run ahead of the migration. a database
+			// migrated further is fine: during a rolling upgrade the first
+			// new replica migrates while the old ones keep serving, and only
+			// starting against it is refused, with sql.ErrSchemaTooNew
+			name: "migrations",
+			check: func(ctx context.Context) error {
+				latest, err := sql.LatestMigration()
+				if err != nil {
+					return err
+				}
+
+				current, err := sql.New(all[0].pool).GetSchemaVersion(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to get schema version: %w", err)
+				}
+
+				if current < latest {
+					return fmt.Errorf("database is at version %d, but this version of jaeger-postgresql needs %d", current, latest)
+				}
+
+				return nil
+			},
+		},
+	}
+
+	if maxUtilization := cfg.Readiness.MaxPoolUtilization; maxUtilization > 0 {
+		checks = append(checks, readinessCheck{
+			name: "pools",
+			check: func(ctx context.Context) error {
+				for _, p := range all {
+					stat := p.pool.Stat()
+					utilization := float64(stat.AcquiredConns()) / float64(stat.MaxConns())
+					if utilization >= maxUtilization {
+						return fmt.Errorf("%s pool is saturated: %d of %d connections in use", p.name, stat.AcquiredConns(), stat.MaxConns())
+					}
+				}
+
+				return nil
+			},
+		})
+	}
+
+	if maxPending := cfg.Readiness.MaxPendingWrites; writer != nil && maxPending > 0 {
+		checks = append(checks, readinessCheck{
+			name: "writer",
+			check: func(ctx context.Context) error {
+				if pending := writer.Pending(); pending > maxPending {
+					return fmt.Errorf("%d spans are pending, more than %d", pending, maxPending)
+				}
+
+				return nil
+			},
+		})
+	}
+
+	if canary != nil {
+		checks = append(checks, readinessCheck{
+			name: "canary",
+			check: func(ctx context.Context) error {
+				return canary.Check()
+			},
+		})
+	}
+
+	return checks
+}
+
+// livezHandler reports that the process is alive. It checks nothing else, so
+// that a slow database does not get the plugin restarted.
+func livezHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// readyzHandler reports whether the plugin is ready to serve, with the result
+// of every check.
+func readyzHandler(readiness *Readiness, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancelFn := context.WithTimeout(r.Context(), time.Second*5)
+		defer cancelFn()
+
+		results, err := readiness.Check(ctx)
+
+		status := http.StatusOK
+		response := struct {
+			Ready  bool          `json:"ready"`
+			Checks []checkResult `json:"checks"`
+		}{Ready: true, Checks: results}
+
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			response.Ready = false
+			logger.Debug("not ready", "err", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.Error("failed to write readiness response", "err", err)
+		}
+	})
+}
+
+// RegisterHealth registers the standard grpc health service on srv, serving
+// while the readiness check passes, and optionally server reflection.
+func RegisterHealth() any {
+	return func(lc fx.Lifecycle, cfg Config, srv *grpc.Server, readiness *Readiness, logger *slog.Logger) {
+		healthSrv := health.NewServer()
+		healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthpb.RegisterHealthServer(srv, healthSrv)
+
+		if cfg.GRPCServer.Reflection {
+			reflection.Register(srv)
+		}
+
+		ctx, cancelFn := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		lc.Append(fx.StartStopHook(
+			func() {
+				// every service is registered by now, so each of them gets a
+				// status besides the overall one
+				var services []string
+				for name := range srv.GetServiceInfo() {
+					services = append(services, name)
+				}
+
+				go func() {
+					defer close(done)
+					watchHealth(ctx, healthSrv, services, readiness, cfg.GRPCServer.HealthCheckInterval, logger)
+				}()
+			},
+
+			// stop hooks run in reverse order, so this runs before the grpc
+			// server is stopped and clients stop sending new requests
+			func() {
+				healthSrv.Shutdown()
+				cancelFn()
+				<-done
+			},
+		))
+	}
+}
+
+// watchHealth sets the status of the services from the readiness check until
+// the context is done.
+func watchHealth(ctx context.Context, healthSrv *health.Server, services []string, readiness *Readiness, interval time.Duration, logger *slog.Logger) {
+	if interval <= 0 {
+		interval = time.Second * 10
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last healthpb.HealthCheckResponse_ServingStatus
+	for {
+		checkCtx, checkCancelFn := context.WithTimeout(ctx, interval)
+		_, err := readiness.Check(checkCtx)
+		checkCancelFn()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		if status != last {
+			logger.Info("grpc health status changed", "status", status.String(), "err", err)
+			last = status
+		}
+
+		healthSrv.SetServingStatus("", status)
+		for _, service := range services {
+			healthSrv.SetServingStatus(service, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,29 +2,48 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/dbpool"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/fieldcrypt"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/interceptors"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/logger"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/maintenance"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/redact"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/retry"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/selftrace"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/slowquery"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/stats"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/store"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/tlsconfig"
+	"github.com/fsnotify/fsnotify"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 // ProvideLogger returns a function that provides a logger
@@ -34,81 +53,459 @@ func ProvideLogger() any {
 	}
 }
 
-// ProvidePgxPool returns a function that provides a pgx pool
+const (
+	// modeReadWrite serves both queries and ingestion.
+	modeReadWrite = "read-write"
+
+	// modeReadOnly only serves queries, e.g. against a hot standby with a
+	// read-only role. It never migrates nor writes to the database.
+	modeReadOnly = "read-only"
+
+	// modeIngestionOnly only accepts spans.
+	modeIngestionOnly = "ingestion-only"
+)
+
+// Pools holds the connection pools. Reads get a pool of their own, which may
+// point at a replica, so that slow searches cannot starve span writes. The
+// read pool is nil in ingestion-only mode, the write pool in read-only mode.
+type Pools struct {
+	Read  *pgxpool.Pool
+	Write *pgxpool.Pool
+}
+
+// primary returns the write pool, or the read pool in read-only mode.
+func (p Pools) primary() *pgxpool.Pool {
+	if p.Write != nil {
+		return p.Write
+	}
+
+	return p.Read
+}
+
+// ProvidePgxPool returns a function that provides the read and write pgx pools
 func ProvidePgxPool() any {
-	return func(cfg Config, logger *slog.Logger, lc fx.Lifecycle) (*pgxpool.Pool, error) {
+	return func(cfg Config, logger *slog.Logger, lc fx.Lifecycle, tracerProvider *sdktrace.TracerProvider, slowLog *slowquery.Log) (Pools, error) {
 		databaseURL := cfg.Database.URL
 		if databaseURL == "" {
-			return nil, fmt.Errorf("invalid database url")
+			return Pools{}, fmt.Errorf("invalid database url")
 		}
 
-		err := sql.Migrate(logger, databaseURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		// the tenant is set per session, which PgBouncer does not preserve
+		// across transactions
+		if cfg.Tenancy.RowLevelSecurity && (cfg.Database.PgBouncer || cfg.Database.Read.PgBouncer) {
+			return Pools{}, fmt.Errorf("tenancy.row-level-security cannot be used with database.pgbouncer")
 		}
 
-		pgxconfig, err := pgxpool.ParseConfig(databaseURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse database url")
+		// the database may come up after the plugin, so wait for it rather
+		// than exit; the admin server reports not ready in the meantime
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// a read-only replica may run against a hot standby, which cannot be
+		// migrated
+		skipMigrations := cfg.SkipMigrations || cfg.Mode == modeReadOnly
+
+		if skipMigrations {
+			logger.Info("skipping migrations")
+
+			err := retry.Do(ctx, cfg.Database.Retry, logger, "check database version", func(ctx context.Context) error {
+				migrationURL, opts := migrationTarget(cfg, logger)
+
+				current, latest, err := sql.MigrationVersions(logger, migrationURL, opts...)
+				if err != nil {
+					return err
+				}
+
+				if current > latest {
+					return retry.Permanent(fmt.Errorf("%w: database is at version %d, but the latest known migration is %d", sql.ErrSchemaTooNew, current, latest))
+				}
+
+				if current < latest {
+					logger.Warn("database is not fully migrated", "version", current, "latest", latest)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return Pools{}, fmt.Errorf("failed to check database version: %w", err)
+			}
+		} else {
+			err := retry.Do(ctx, cfg.Database.Retry, logger, "migrate database", func(ctx context.Context) error {
+				return migrate(cfg, logger)
+			})
+			if err != nil {
+				return Pools{}, fmt.Errorf("failed to migrate database: %w", err)
+			}
+		}
+
+		var tracers dbpool.QueryTracers
+		if tracerProvider != nil {
+			tracers = append(tracers, selftrace.NewQueryTracer(tracerProvider))
+		}
+		if slowLog != nil {
+			tracers = append(tracers, slowLog)
+		}
+
+		var pools Pools
+		closePools := func() {
+			if pools.Read != nil {
+				pools.Read.Close()
+			}
+
+			if pools.Write != nil {
+				pools.Write.Close()
+			}
 		}
 
-		// handle max conns
-		{
-			var maxConns int32
-			if cfg.Database.MaxConns == 0 {
-				maxConns = 20
-			} else {
-				maxConns = int32(cfg.Database.MaxConns)
+		if cfg.Mode != modeReadOnly {
+			err := retry.Do(ctx, cfg.Database.Retry, logger, "connect write pool", func(ctx context.Context) error {
+				var err error
+				pools.Write, err = newPool(ctx, cfg, databaseURL, cfg.Database.Config, tracers, logger)
+				return err
+			})
+			if err != nil {
+				return Pools{}, fmt.Errorf("failed to create write pool: %w", err)
 			}
 
-			pgxconfig.MaxConns = maxConns
+			prometheus.MustRegister(dbpool.NewCollector("write", pools.Write))
 		}
 
-		// handle timeout duration
-		connectTimeoutDuration := time.Second * 10
-		pgxconfig.ConnConfig.ConnectTimeout = connectTimeoutDuration
+		// altering the row level security of the tables is DDL too, left to
+		// the replicas that migrate
+		if !skipMigrations {
+			setupCtx, cancelFn := context.WithTimeout(ctx, pools.Write.Config().ConnConfig.ConnectTimeout)
+			defer cancelFn()
 
-		ctx, cancelFn := context.WithTimeout(context.Background(), connectTimeoutDuration)
-		defer cancelFn()
+			err := sql.New(pools.Write).SetRowLevelSecurity(setupCtx, cfg.Tenancy.RowLevelSecurity)
+			if err != nil {
+				closePools()
+				return Pools{}, fmt.Errorf("failed to configure row level security: %w", err)
+			}
+		}
+
+		if cfg.Mode != modeIngestionOnly {
+			readURL := cfg.Database.Read.URL
+			if readURL == "" {
+				readURL = databaseURL
+			}
+
+			err := retry.Do(ctx, cfg.Database.Retry, logger, "connect read pool", func(ctx context.Context) error {
+				var err error
+				pools.Read, err = newPool(ctx, cfg, readURL, cfg.Database.Read.Config, tracers, logger)
+				return err
+			})
+			if err != nil {
+				closePools()
+				return Pools{}, fmt.Errorf("failed to create read pool: %w", err)
+			}
+
+			prometheus.MustRegister(dbpool.NewCollector("read", pools.Read))
+
+			// FindTraceIDs runs on the read pool, so it is explained there
+			if slowLog != nil {
+				slowLog.SetExplainDB(pools.Read)
+			}
+		}
+
+		// the policies do not apply to superusers and roles with BYPASSRLS,
+		// which would see the spans of every tenant
+		if cfg.Tenancy.RowLevelSecurity {
+			primary := pools.primary()
+
+			setupCtx, cancelFn := context.WithTimeout(ctx, primary.Config().ConnConfig.ConnectTimeout)
+			defer cancelFn()
+
+			role, err := sql.New(primary).GetCurrentRole(setupCtx)
+			if err != nil {
+				closePools()
+				return Pools{}, fmt.Errorf("failed to get current role: %w", err)
+			}
+
+			if role.BypassRls {
+				logger.Warn("row level security is enabled but the plugin's role bypasses it, so it does not isolate tenants; connect as a role without SUPERUSER or BYPASSRLS", "role", role.Name)
+			}
+		}
 
-		pool, err := pgxpool.NewWithConfig(ctx, pgxconfig)
+		logger.Info("connected to postgres", "mode", cfg.Mode)
+
+		lc.Append(fx.StopHook(closePools))
+
+		return pools, nil
+	}
+}
+
+// migrate migrates the database. A database migrated by a newer binary is a
+// permanent error, as waiting will not fix it.
+func migrate(cfg Config, logger *slog.Logger) error {
+	migrationURL, opts := migrationTarget(cfg, logger)
+
+	err := sql.Migrate(logger, migrationURL, opts...)
+	if errors.Is(err, sql.ErrSchemaTooNew) {
+		return retry.Permanent(err)
+	}
+
+	return err
+}
+
+// migrationTarget returns the url and options to migrate the database with,
+// using the migration url if one is set.
+func migrationTarget(cfg Config, logger *slog.Logger) (string, []sql.MigrateOption) {
+	opts := []sql.MigrateOption{
+		sql.WithSchema(cfg.Database.Schema),
+		sql.WithLockTimeout(cfg.Database.MigrationLockTimeout),
+	}
+
+	migrationURL := cfg.Database.MigrationURL
+	if migrationURL == "" {
+		migrationURL = cfg.Database.URL
+
+		if cfg.Database.PgBouncer {
+			// the session level migration lock is not reliable when the
+			// session may move between server connections
+			logger.Warn("migrating through pgbouncer, set database.migration-url to connect directly")
+			opts = append(opts, sql.WithQueryExecMode(dbpool.PgBouncerQueryExecMode))
+		}
+	}
+
+	return migrationURL, opts
+}
+
+// newPool connects a pool to the database at url, failing if the database
+// cannot be reached. Queries are passed to the tracers.
+func newPool(ctx context.Context, cfg Config, url string, poolCfg dbpool.Config, tracers dbpool.QueryTracers, logger *slog.Logger) (*pgxpool.Pool, error) {
+	pgxconfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database url")
+	}
+
+	// handle pool size, lifetimes and timeouts
+	poolCfg.Apply(pgxconfig)
+
+	// handle schema
+	sql.SetSearchPath(pgxconfig.ConnConfig, cfg.Database.Schema)
+
+	// handle self tracing and the slow query log
+	if len(tracers) > 0 {
+		pgxconfig.ConnConfig.Tracer = tracers
+	}
+
+	// handle row level security, which needs every connection to carry
+	// the tenant of the request it is acquired for. setting it costs a
+	// round trip, but only when a connection changes tenants.
+	if cfg.Tenancy.RowLevelSecurity {
+		tenants := dbpool.NewTenantSetter(logger)
+		pgxconfig.BeforeAcquire = tenants.BeforeAcquire
+		pgxconfig.BeforeClose = tenants.BeforeClose
+	}
+
+	ctx, cancelFn := context.WithTimeout(ctx, pgxconfig.ConnConfig.ConnectTimeout)
+	defer cancelFn()
+
+	pool, err := pgxpool.NewWithConfig(ctx, pgxconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the postgres database: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to the postgres database: %w", err)
+	}
+
+	return pool, nil
+}
+
+// ProvideCipher returns a function that provides the tag cipher, or nil if
+// no keyfile is configured
+func ProvideCipher() any {
+	return func(cfg Config) (*fieldcrypt.Cipher, error) {
+		if cfg.Encryption.KeyFile == "" {
+			return nil, nil
+		}
+
+		cipher, err := fieldcrypt.Load(cfg.Encryption.KeyFile, cfg.Encryption.Tags)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to the postgres database: %w", err)
+			return nil, fmt.Errorf("failed to load encryption keys: %w", err)
 		}
 
-		logger.Info("connected to postgres")
+		return cipher, nil
+	}
+}
 
-		lc.Append(fx.Hook{
-			OnStop: func(ctx context.Context) error {
-				pool.Close()
-				return nil
-			},
-		})
+// ProvideTracerProvider returns a function that provides the tracer provider of
+// self tracing, or nil if it is disabled
+func ProvideTracerProvider() any {
+	return func(cfg Config, lc fx.Lifecycle) (*sdktrace.TracerProvider, error) {
+		if !cfg.Tracing.Enabled() {
+			return nil, nil
+		}
 
-		return pool, nil
+		tracerProvider, err := selftrace.NewTracerProvider(context.Background(), cfg.Tracing, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure tracing: %w", err)
+		}
+
+		// flushes the spans that are still buffered
+		lc.Append(fx.StopHook(tracerProvider.Shutdown))
+
+		return tracerProvider, nil
+	}
+}
+
+// ProvideSlowQueryLog returns a function that provides the slow query log, or
+// nil if it is disabled
+func ProvideSlowQueryLog() any {
+	return func(cfg Config, logger *slog.Logger) (*slowquery.Log, error) {
+		if !cfg.SlowQueries.Enabled() {
+			return nil, nil
+		}
+
+		switch cfg.SlowQueries.Explain {
+		case slowquery.ExplainNone, slowquery.ExplainLog, slowquery.ExplainEndpoint:
+		default:
+			return nil, fmt.Errorf("invalid slow-queries.explain: %q", cfg.SlowQueries.Explain)
+		}
+
+		return slowquery.New(cfg.SlowQueries, logger.With("component", "slow-queries")), nil
 	}
 }
 
 // ProvideSpanStoreReader returns a function that provides a spanstore reader.
 func ProvideSpanStoreReader() any {
-	return func(pool *pgxpool.Pool, logger *slog.Logger) spanstore.Reader {
-		q := sql.New(pool)
-		return store.NewInstrumentedReader(store.NewReader(q, logger), logger)
+	return func(cfg Config, pools Pools, logger *slog.Logger, cipher *fieldcrypt.Cipher, tracerProvider *sdktrace.TracerProvider) spanstore.Reader {
+		if pools.Read == nil {
+			return store.IngestionOnlyReader{}
+		}
+
+		opts := []store.ReaderOption{store.WithGuardrails(store.Guardrails{
+			MaxLookback:     cfg.Search.MaxLookback,
+			DefaultLookback: cfg.Search.DefaultLookback,
+			MaxNumTraces:    cfg.Search.MaxNumTraces,
+			MaxCost:         cfg.Search.MaxCost,
+		})}
+		if cipher != nil {
+			opts = append(opts, store.WithReaderCipher(cipher))
+		}
+
+		q := sql.New(pools.Read)
+		var reader spanstore.Reader = store.NewReader(q, logger, opts...)
+		if tracerProvider != nil {
+			reader = store.NewTracingReader(reader, tracerProvider)
+		}
+
+		return store.NewInstrumentedReader(reader, logger)
+	}
+}
+
+// ProvideWriter returns a function that provides the postgres writer, or nil
+// in read-only mode
+func ProvideWriter() any {
+	return func(cfg Config, pools Pools, logger *slog.Logger, quotas *store.QuotaEnforcer, redactor *redact.Redactor, cipher *fieldcrypt.Cipher) *store.Writer {
+		if pools.Write == nil {
+			return nil
+		}
+
+		opts := []store.WriterOption{store.WithQuotas(quotas)}
+		if redactor != nil {
+			opts = append(opts, store.WithRedactor(redactor))
+		}
+		if cipher != nil {
+			opts = append(opts, store.WithWriterCipher(cipher))
+		}
+		if cfg.Operations.MaxPerService > 0 {
+			opts = append(opts, store.WithOperationLimit(cfg.Operations.MaxPerService, cfg.Operations.Placeholder))
+		}
+		if cfg.Usage.FlushInterval > 0 {
+			opts = append(opts, store.WithUsageTracking())
+		}
+
+		q := sql.New(pools.Write)
+		return store.NewWriter(q, logger, opts...)
+	}
+}
+
+// ProvideCanary returns a function that provides the canary, or nil if it is
+// disabled or the plugin cannot both write and read
+func ProvideCanary() any {
+	return func(cfg Config, pools Pools, writer *store.Writer, reader spanstore.Reader, logger *slog.Logger) *store.Canary {
+		if !cfg.Canary.Enabled || writer == nil || pools.Read == nil {
+			return nil
+		}
+
+		return store.NewCanary(writer, reader, sql.New(pools.Write), logger.With("component", "canary"), cfg.Canary.Timeout)
+	}
+}
+
+// ProvideQuotaEnforcer returns a function that provides the per-service quota enforcer
+func ProvideQuotaEnforcer() any {
+	return func(cfg Config, logger *slog.Logger) *store.QuotaEnforcer {
+		return store.NewQuotaEnforcer(cfg.quotaConfig(), logger.With("component", "quotas"))
+	}
+}
+
+// ProvideRedactor returns a function that provides the redactor, or nil if
+// no redaction rules are configured
+func ProvideRedactor() any {
+	return func(cfg Config) (*redact.Redactor, error) {
+		if len(cfg.Redaction.Rules) == 0 {
+			return nil, nil
+		}
+
+		var hashKey []byte
+		if cfg.Redaction.HashKeyFile != "" {
+			var err error
+			hashKey, err = os.ReadFile(cfg.Redaction.HashKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read redaction hash key: %w", err)
+			}
+		}
+
+		rules := make([]redact.Rule, len(cfg.Redaction.Rules))
+		for i, rule := range cfg.Redaction.Rules {
+			rules[i] = redact.Rule{
+				Name:         rule.Name,
+				Keys:         rule.Keys,
+				ValuePattern: rule.ValuePattern,
+				Action:       redact.Action(rule.Action),
+			}
+		}
+
+		redactor, err := redact.New(redact.Config{
+			AllowKeys: cfg.Redaction.AllowKeys,
+			Rules:     rules,
+			Mask:      cfg.Redaction.Mask,
+			HashKey:   hashKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction config: %w", err)
+		}
+
+		return redactor, nil
 	}
 }
 
 // ProvideSpanStoreWriter returns a function that provides a spanstore writer
 func ProvideSpanStoreWriter() any {
-	return func(pool *pgxpool.Pool, logger *slog.Logger) spanstore.Writer {
-		q := sql.New(pool)
-		return store.NewInstrumentedWriter(store.NewWriter(q, logger), logger)
+	return func(cfg Config, writer *store.Writer, logger *slog.Logger, tracerProvider *sdktrace.TracerProvider) spanstore.Writer {
+		if writer == nil {
+			return store.ReadOnlyWriter{}
+		}
+
+		if tracerProvider != nil {
+			return store.NewInstrumentedWriter(store.NewTracingWriter(writer, tracerProvider, cfg.Tracing.SelfServiceName()), logger)
+		}
+
+		return store.NewInstrumentedWriter(writer, logger)
 	}
 }
 
 // ProvideDependencyStoreReader provides a dependencystore reader
 func ProvideDependencyStoreReader() any {
-	return func(pool *pgxpool.Pool, logger *slog.Logger) dependencystore.Reader {
-		q := sql.New(pool)
+	return func(pools Pools, logger *slog.Logger) dependencystore.Reader {
+		if pools.Read == nil {
+			return store.IngestionOnlyReader{}
+		}
+
+		q := sql.New(pools.Read)
 		return store.NewReader(q, logger)
 	}
 }
@@ -129,10 +526,78 @@ func ProvideHandler() any {
 	}
 }
 
+// parseAccessLogLevel parses the level of the grpc access log. It lives outside
+// of ProvideGRPCServer, where the logger package is shadowed.
+func parseAccessLogLevel(cfg Config) (slog.Level, error) {
+	level, err := logger.ParseLevel(cfg.GRPCServer.AccessLogLevel)
+	if err != nil {
+		return 0, fmt.Errorf("invalid grpc-server.access-log-level: %w", err)
+	}
+
+	return level, nil
+}
+
 // ProvideGRPCServer provides a grpc server.
 func ProvideGRPCServer() any {
 	return func(lc fx.Lifecycle, cfg Config, logger *slog.Logger) (*grpc.Server, error) {
-		srv := grpc.NewServer()
+		accessLogLevel, err := parseAccessLogLevel(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		// the observer comes first so that it sees the errors of the
+		// interceptors after it, including recovered panics
+		observer := interceptors.NewObserver(logger.With("component", "grpc"), accessLogLevel)
+		opts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(observer.Unary(), interceptors.RecoverUnary(logger)),
+			grpc.ChainStreamInterceptor(observer.Stream(), interceptors.RecoverStream(logger)),
+			grpc.KeepaliveParams(keepalive.ServerParameters{
+				MaxConnectionIdle:     cfg.GRPCServer.Keepalive.MaxConnectionIdle,
+				MaxConnectionAge:      cfg.GRPCServer.Keepalive.MaxConnectionAge,
+				MaxConnectionAgeGrace: cfg.GRPCServer.Keepalive.MaxConnectionAgeGrace,
+				Time:                  cfg.GRPCServer.Keepalive.Time,
+				Timeout:               cfg.GRPCServer.Keepalive.Timeout,
+			}),
+			grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             cfg.GRPCServer.Keepalive.MinTime,
+				PermitWithoutStream: cfg.GRPCServer.Keepalive.PermitWithoutStream,
+			}),
+		}
+
+		if cfg.GRPCServer.MaxRecvMsgSize > 0 {
+			opts = append(opts, grpc.MaxRecvMsgSize(cfg.GRPCServer.MaxRecvMsgSize))
+		}
+
+		if cfg.GRPCServer.MaxSendMsgSize > 0 {
+			opts = append(opts, grpc.MaxSendMsgSize(cfg.GRPCServer.MaxSendMsgSize))
+		}
+
+		if cfg.Tenancy.Enabled {
+			// rejects requests without a valid tenant header, and moves the
+			// tenant from the metadata into the context. health checks and
+			// reflection carry no tenant, and read no tenant data.
+			manager := tenancy.NewManager(&tenancy.Options{
+				Enabled: true,
+				Header:  cfg.Tenancy.Header,
+				Tenants: cfg.Tenancy.Tenants,
+			})
+
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(interceptors.ExemptUnary(tenancy.NewGuardingUnaryInterceptor(manager), interceptors.InfrastructureMethods...)),
+				grpc.ChainStreamInterceptor(interceptors.ExemptStream(tenancy.NewGuardingStreamInterceptor(manager), interceptors.InfrastructureMethods...)),
+			)
+		}
+
+		if cfg.GRPCServer.TLS.Enabled() {
+			tlsConfig, err := newTLSConfig(lc, cfg.GRPCServer.TLS, logger.With("component", "grpc-tls"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure grpc-server tls: %w", err)
+			}
+
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+
+		srv := grpc.NewServer(opts...)
 
 		if cfg.GRPCServer.HostPort == "" {
 			return nil, fmt.Errorf("invalid grpc-server.host-port given: %s", cfg.GRPCServer.HostPort)
@@ -152,7 +617,20 @@ func ProvideGRPCServer() any {
 			},
 
 			func(ctx context.Context) error {
-				srv.GracefulStop()
+				// streams such as health watches never finish on their own,
+				// so stop forcibly once the stop timeout is up
+				stopped := make(chan struct{})
+				go func() {
+					defer close(stopped)
+					srv.GracefulStop()
+				}()
+
+				select {
+				case <-stopped:
+				case <-ctx.Done():
+					srv.Stop()
+				}
+
 				return lis.Close()
 			},
 		))
@@ -161,6 +639,29 @@ func ProvideGRPCServer() any {
 	}
 }
 
+// newTLSConfig returns a server tls config for the files of cfg, which are
+// reloaded when they change.
+func newTLSConfig(lc fx.Lifecycle, cfg tlsconfig.Config, logger *slog.Logger) (*tls.Config, error) {
+	reloader, err := tlsconfig.NewReloader(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.StopHook(func() {
+		cancelFn()
+		<-done
+	}))
+
+	go func() {
+		defer close(done)
+		reloader.Run(ctx)
+	}()
+
+	return reloader.TLSConfig(), nil
+}
+
 // ProvideAdminServer provides the admin http server.
 func ProvideAdminServer() any {
 	return func(lc fx.Lifecycle, cfg Config, logger *slog.Logger) (*http.ServeMux, error) {
@@ -181,62 +682,272 @@ func ProvideAdminServer() any {
 
 		logger.Info("admin server started", "addr", lis.Addr())
 
-		lc.Append(fx.StartStopHook(
-			func(ctx context.Context) error {
-				go srv.Serve(lis)
-				return nil
-			},
+		// serve right away rather than on start, so that health checks are
+		// answered while waiting for the database
+		if cfg.Admin.HTTP.TLS.Enabled() {
+			tlsConfig, err := newTLSConfig(lc, cfg.Admin.HTTP.TLS, logger.With("component", "admin-tls"))
+			if err != nil {
+				lis.Close()
+				return nil, fmt.Errorf("failed to configure admin.http tls: %w", err)
+			}
 
-			func(ctx context.Context) error {
-				return srv.Shutdown(ctx)
-			},
-		))
+			srv.TLSConfig = tlsConfig
+			go srv.ServeTLS(lis, "", "")
+		} else {
+			go srv.Serve(lis)
+		}
+
+		lc.Append(fx.StopHook(func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		}))
 
 		return mux, nil
 	}
 }
 
-var (
-	spansTableDiskSizeGuage = promauto.NewGauge(prometheus.GaugeOpts{
-		Namespace: "jaeger_postgresql",
-		Name:      "spans_table_bytes",
-		Help:      "The size of the spans table in bytes",
-	})
-
-	spansGuage = promauto.NewGauge(prometheus.GaugeOpts{
-		Namespace: "jaeger_postgresql",
-		Name:      "spans_count",
-		Help:      "The number of spans",
-	})
-)
-
 // Config is the configuration struct for the jaeger-postgresql service.
 type Config struct {
 	Database struct {
-		URL      string `mapstructure:"url"`
-		MaxConns int    `mapstructure:"max-conns"`
+		URL                  string        `mapstructure:"url"`
+		MigrationURL         string        `mapstructure:"migration-url"`
+		MigrationLockTimeout time.Duration `mapstructure:"migration-lock-timeout"`
+		Schema               string        `mapstructure:"schema"`
+		Retry                retry.Config  `mapstructure:"retry"`
+		dbpool.Config        `mapstructure:",squash"`
+
+		Read struct {
+			URL           string `mapstructure:"url"`
+			dbpool.Config `mapstructure:",squash"`
+		} `mapstructure:"read"`
 	} `mapstructure:"database"`
 
 	LogLevel string `mapstructure:"log-level"`
 
+	SkipMigrations bool `mapstructure:"skip-migrations"`
+
+	Mode string `mapstructure:"mode"`
+
 	GRPCServer struct {
-		HostPort string `mapstructure:"host-port"`
+		HostPort       string           `mapstructure:"host-port"`
+		TLS            tlsconfig.Config `mapstructure:"tls"`
+		AccessLogLevel string           `mapstructure:"access-log-level"`
+		MaxRecvMsgSize int              `mapstructure:"max-recv-msg-size"`
+		MaxSendMsgSize int              `mapstructure:"max-send-msg-size"`
+
+		HealthCheckInterval time.Duration `mapstructure:"health-check-interval"`
+		Reflection          bool          `mapstructure:"reflection"`
+
+		Keepalive struct {
+			Time                  time.Duration `mapstructure:"time"`
+			Timeout               time.Duration `mapstructure:"timeout"`
+			MaxConnectionIdle     time.Duration `mapstructure:"max-connection-idle"`
+			MaxConnectionAge      time.Duration `mapstructure:"max-connection-age"`
+			MaxConnectionAgeGrace time.Duration `mapstructure:"max-connection-age-grace"`
+			MinTime               time.Duration `mapstructure:"min-time"`
+			PermitWithoutStream   bool          `mapstructure:"permit-without-stream"`
+		} `mapstructure:"keepalive"`
 	} `mapstructure:"grpc-server"`
 
 	Admin struct {
 		HTTP struct {
-			HostPort string `mapstructure:"host-port"`
+			HostPort string           `mapstructure:"host-port"`
+			TLS      tlsconfig.Config `mapstructure:"tls"`
 		}
 	}
+
+	Tenancy struct {
+		Enabled          bool     `mapstructure:"enabled"`
+		Header           string   `mapstructure:"header"`
+		Tenants          []string `mapstructure:"tenants"`
+		RowLevelSecurity bool     `mapstructure:"row-level-security"`
+	} `mapstructure:"tenancy"`
+
+	Stats struct {
+		Interval time.Duration `mapstructure:"interval"`
+	} `mapstructure:"stats"`
+
+	Usage struct {
+		FlushInterval time.Duration `mapstructure:"flush-interval"`
+	} `mapstructure:"usage"`
+
+	Quotas struct {
+		WarnInterval time.Duration `mapstructure:"warn-interval"`
+		Default      QuotaConfig   `mapstructure:"default"`
+		Services     []struct {
+			Name        string `mapstructure:"name"`
+			QuotaConfig `mapstructure:",squash"`
+		} `mapstructure:"services"`
+	} `mapstructure:"quotas"`
+
+	Operations struct {
+		MaxPerService int    `mapstructure:"max-per-service"`
+		Placeholder   string `mapstructure:"placeholder"`
+	} `mapstructure:"operations"`
+
+	Redaction struct {
+		AllowKeys   []string `mapstructure:"allow-keys"`
+		Mask        string   `mapstructure:"mask"`
+		HashKeyFile string   `mapstructure:"hash-key-file"`
+		Rules       []struct {
+			Name         string   `mapstructure:"name"`
+			Keys         []string `mapstructure:"keys"`
+			ValuePattern string   `mapstructure:"value-pattern"`
+			Action       string   `mapstructure:"action"`
+		} `mapstructure:"rules"`
+	} `mapstructure:"redaction"`
+
+	Encryption struct {
+		KeyFile string   `mapstructure:"keyfile"`
+		Tags    []string `mapstructure:"tags"`
+	} `mapstructure:"encryption"`
+
+	Canary struct {
+		Enabled  bool          `mapstructure:"enabled"`
+		Interval time.Duration `mapstructure:"interval"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"canary"`
+
+	Tracing selftrace.Config `mapstructure:"tracing"`
+
+	SlowQueries slowquery.Config `mapstructure:"slow-queries"`
+
+	Search struct {
+		MaxLookback     time.Duration `mapstructure:"max-lookback"`
+		DefaultLookback time.Duration `mapstructure:"default-lookback"`
+		MaxNumTraces    int           `mapstructure:"max-num-traces"`
+		MaxCost         float64       `mapstructure:"max-cost"`
+	} `mapstructure:"search"`
+
+	Readiness struct {
+		MaxPoolUtilization float64 `mapstructure:"max-pool-utilization"`
+		MaxPendingWrites   int64   `mapstructure:"max-pending-writes"`
+	} `mapstructure:"readiness"`
+
+	Maintenance struct {
+		Enabled         bool          `mapstructure:"enabled"`
+		VacuumInterval  time.Duration `mapstructure:"vacuum-interval"`
+		ReindexInterval time.Duration `mapstructure:"reindex-interval"`
+		StatsInterval   time.Duration `mapstructure:"stats-interval"`
+	} `mapstructure:"maintenance"`
+}
+
+// QuotaConfig is the configuration of a single service quota.
+type QuotaConfig struct {
+	SpansPerSecond float64 `mapstructure:"spans-per-second"`
+	SpansPerDay    int64   `mapstructure:"spans-per-day"`
+}
+
+func (c QuotaConfig) quota() store.Quota {
+	return store.Quota{SpansPerSecond: c.SpansPerSecond, SpansPerDay: c.SpansPerDay}
+}
+
+// quotaConfig converts the quotas section of the config to a store.QuotaConfig.
+func (cfg Config) quotaConfig() store.QuotaConfig {
+	services := make(map[string]store.Quota, len(cfg.Quotas.Services))
+	for _, service := range cfg.Quotas.Services {
+		services[service.Name] = service.quota()
+	}
+
+	return store.QuotaConfig{
+		Default:      cfg.Quotas.Default.quota(),
+		Services:     services,
+		WarnInterval: cfg.Quotas.WarnInterval,
+	}
+}
+
+// tlsFlags defines the flags of the tls configured under prefix.
+func tlsFlags(prefix string, server string) {
+	pflag.String(prefix+".cert", "", "Path to the PEM encoded certificate of "+server+"; enables tls")
+	pflag.String(prefix+".key", "", "Path to the PEM encoded private key of "+server)
+	pflag.String(prefix+".client-ca", "", "Path to the PEM encoded CAs that client certificates of "+server+" must be signed by; enables mutual tls")
+	pflag.String(prefix+".min-version", "1.2", "The minimum tls version of "+server+" (1.0, 1.1, 1.2 or 1.3)")
+	pflag.Duration(prefix+".reload-interval", tlsconfig.DefaultReloadInterval, "How often to check the certificate, key and client CA files of "+server+" for changes")
+}
+
+// poolFlags defines the flags of the connection pool configured under prefix.
+func poolFlags(prefix string, purpose string) {
+	pflag.Int(prefix+".max-conns", dbpool.DefaultMaxConns, "Max number of database connections of which the plugin will try to maintain at any given time for "+purpose)
+	pflag.Int(prefix+".min-conns", 0, "Min number of database connections kept open for "+purpose)
+	pflag.Duration(prefix+".connect-timeout", dbpool.DefaultConnectTimeout, "Timeout for establishing a database connection for "+purpose)
+	pflag.Duration(prefix+".max-conn-lifetime", time.Hour, "Duration after which a connection for "+purpose+" is closed and replaced")
+	pflag.Duration(prefix+".max-conn-idle-time", time.Minute*30, "Duration after which an idle connection for "+purpose+" is closed")
+	pflag.Duration(prefix+".health-check-period", time.Minute, "How often idle connections for "+purpose+" are checked")
+	pflag.Duration(prefix+".statement-timeout", 0, "The postgres statement_timeout of connections for "+purpose+" (0 uses the server default)")
+	pflag.Duration(prefix+".lock-timeout", 0, "The postgres lock_timeout of connections for "+purpose+" (0 uses the server default)")
+	pflag.String(prefix+".application-name", "jaeger-postgresql", "The postgres application_name of connections for "+purpose)
+	pflag.Bool(prefix+".pgbouncer", false, "Whether connections for "+purpose+" go through PgBouncer in transaction pooling mode, which rules out named prepared statements. PgBouncer rejects the schema, statement-timeout and lock-timeout startup parameters unless they are in its ignore_startup_parameters, in which case they must be set on the database role instead")
 }
 
-func ProvideConfig() func() (Config, error) {
-	return func() (Config, error) {
+func ProvideConfig() func() (Config, *viper.Viper, error) {
+	return func() (Config, *viper.Viper, error) {
 		pflag.String("database.url", "", "the postgres connection url to use to connect to the database")
-		pflag.Int("database.max-conns", 20, "Max number of database connections of which the plugin will try to maintain at any given time")
+		poolFlags("database", "writing spans")
+		pflag.String("database.read.url", "", "the postgres connection url used for searches and trace lookups, e.g. of a read replica (defaults to database.url)")
+		poolFlags("database.read", "reads")
+		pflag.String("database.migration-url", "", "the postgres connection url to run migrations over, e.g. to bypass PgBouncer (defaults to database.url)")
+		pflag.Duration("database.retry.initial-interval", retry.DefaultInitialInterval, "How long to wait before retrying to connect to or migrate the database the first time; the wait doubles with every attempt")
+		pflag.Duration("database.retry.max-interval", retry.DefaultMaxInterval, "The longest wait between two attempts to connect to or migrate the database")
+		pflag.Duration("database.retry.max-elapsed-time", time.Minute*5, "How long to keep retrying to connect to or migrate the database before exiting (0 retries forever)")
+		pflag.Duration("database.migration-lock-timeout", time.Minute*5, "How long to wait for another replica or the cleaner to finish migrating the database (0 waits indefinitely)")
+		pflag.String("database.schema", "", "the schema to store the tables in, created if it does not exist; lets several deployments share one database. Defaults to the search_path of the database user")
 		pflag.String("log-level", "warn", "Minimal allowed log level")
+		pflag.String("mode", modeReadWrite, "Which side of the storage to serve: read-write, read-only (queries only; no migrations, statistics collection or maintenance) or ingestion-only (spans only)")
+		pflag.Bool("skip-migrations", false, "Whether to skip migrating the database and configuring row level security, e.g. for replicas that must never run DDL. Another replica or the cleaner has to migrate instead")
 		pflag.String("grpc-server.host-port", ":12345", "the host:port (eg 127.0.0.1:12345 or :12345) of the storage provider's gRPC server")
+		tlsFlags("grpc-server.tls", "the gRPC storage server")
+		pflag.String("grpc-server.access-log-level", "debug", "The log level of the access log of gRPC requests; requests are only logged when log-level allows it")
+		pflag.Int("grpc-server.max-recv-msg-size", 0, "The maximum size in bytes of a gRPC message the server receives (0 uses the gRPC default of 4MiB)")
+		pflag.Int("grpc-server.max-send-msg-size", 0, "The maximum size in bytes of a gRPC message the server sends (0 is unlimited)")
+		pflag.Duration("grpc-server.keepalive.time", time.Hour*2, "How long a connection is idle before the server pings the client")
+		pflag.Duration("grpc-server.keepalive.timeout", time.Second*20, "How long the server waits for a ping to be acknowledged before closing the connection")
+		pflag.Duration("grpc-server.keepalive.max-connection-idle", 0, "How long a connection may have no active calls before it is closed (0 is unlimited)")
+		pflag.Duration("grpc-server.keepalive.max-connection-age", 0, "How long a connection may live before it is gracefully closed, e.g. to rebalance clients across replicas (0 is unlimited)")
+		pflag.Duration("grpc-server.keepalive.max-connection-age-grace", 0, "How long calls may continue after max-connection-age before the connection is closed forcibly (0 is unlimited)")
+		pflag.Duration("grpc-server.keepalive.min-time", time.Minute*5, "The minimum time between client pings; clients pinging more often are disconnected")
+		pflag.Bool("grpc-server.keepalive.permit-without-stream", false, "Whether clients may ping when there are no active calls")
+		pflag.Duration("grpc-server.health-check-interval", time.Second*10, "How often the database is checked to update the status of the grpc.health.v1.Health service")
+		pflag.Bool("grpc-server.reflection", false, "Whether to register the gRPC server reflection service, e.g. for grpcurl")
 		pflag.String("admin.http.host-port", ":12346", "The host:port (e.g. 127.0.0.1:12346 or :12346) for the admin server, including health check, /metrics, etc.")
+		tlsFlags("admin.http.tls", "the admin server")
+		pflag.Bool("tenancy.enabled", false, "Whether to isolate the data of the tenants that jaeger forwards in the tenancy header")
+		pflag.String("tenancy.header", "x-tenant", "The gRPC metadata key jaeger sends the tenant in")
+		pflag.StringSlice("tenancy.tenants", nil, "The tenants that are accepted (empty accepts every tenant)")
+		pflag.Bool("tenancy.row-level-security", false, "Whether to also enforce tenant isolation with postgres row level security policies. The policies do not apply to superusers or roles with BYPASSRLS, so the plugin must not connect as one")
+		pflag.Duration("stats.interval", time.Second*30, "How often to collect table and index statistics from the database (0 disables)")
+		pflag.Duration("usage.flush-interval", time.Minute, "How often to add per-service span counts and bytes to the service_usage_daily table (0 disables)")
+		pflag.Duration("quotas.warn-interval", time.Minute, "Minimum time between two warnings about the same service exceeding its quota")
+		pflag.Float64("quotas.default.spans-per-second", 0, "Maximum number of spans per second a service may write, unless overridden in quotas.services (0 is unlimited)")
+		pflag.Int64("quotas.default.spans-per-day", 0, "Maximum number of spans per day a service may write, unless overridden in quotas.services (0 is unlimited)")
+		pflag.Int("operations.max-per-service", 0, "Maximum number of distinct operations stored per service, operations.placeholder included; further operations are collapsed into the placeholder (0 is unlimited)")
+		pflag.String("operations.placeholder", "<other>", "The operation name that new operations are collapsed into once a service reaches operations.max-per-service")
+		pflag.StringSlice("redaction.allow-keys", nil, "Tag keys that are never redacted; redaction rules themselves are configured in the config file")
+		pflag.String("redaction.mask", redact.DefaultMask, "The value that replaces values redacted with the mask action")
+		pflag.String("redaction.hash-key-file", "", "Path to a file holding the HMAC key for values redacted with the hash action")
+		pflag.String("encryption.keyfile", "", "Path to the JSON keyfile holding the keys used to encrypt the values of encryption.tags")
+		pflag.StringSlice("encryption.tags", nil, "Tag keys whose values are encrypted at rest and searchable only by exact match")
+		pflag.Bool("canary.enabled", false, "Whether to periodically write a span and read it back, failing readiness when either fails")
+		pflag.Duration("canary.interval", time.Minute, "How often the canary span is written")
+		pflag.Duration("canary.timeout", time.Second*10, "How long the canary span may take to be written and read back")
+		pflag.String("tracing.exporter", selftrace.ExporterNone, "How to export traces of the plugin itself: none, otlp or stdout")
+		pflag.String("tracing.endpoint", "localhost:4317", "The host:port of the OTLP gRPC receiver that self traces are exported to")
+		pflag.Bool("tracing.insecure", false, "Whether to export self traces over OTLP without TLS")
+		pflag.String("tracing.service-name", selftrace.DefaultServiceName, "The service name of self traces; spans written under it are not traced, so that self traces stored by this plugin do not loop")
+		pflag.Float64("tracing.sample-ratio", 1, "The share of self traces that are sampled, from 0 to 1")
+		pflag.Duration("slow-queries.threshold", 0, "The duration above which queries are logged as slow; 0 disables the slow query log")
+		pflag.Bool("slow-queries.mask-tags", true, "Whether to mask the tag values in the parameters of slow queries")
+		pflag.String("slow-queries.explain", slowquery.ExplainNone, "Where to capture EXPLAIN (ANALYZE, BUFFERS) of slow FindTraceIDs queries: none, log or endpoint (/debug/slow-queries on the admin server)")
+		pflag.Duration("slow-queries.explain-timeout", time.Second*30, "How long capturing the plan of a slow query may take")
+		pflag.Int("slow-queries.keep", slowquery.DefaultKeep, "The number of slow queries shown on /debug/slow-queries")
+		pflag.Duration("search.max-lookback", 0, "The longest time range a trace search may cover; searches over longer ranges are rejected (0 is unlimited)")
+		pflag.Duration("search.default-lookback", time.Hour*24, "The time range, ending now, searched when a trace search has no start time (0 searches all time)")
+		pflag.Int("search.max-num-traces", 1000, "The most traces a trace search returns; searches asking for more get this many (0 is unlimited)")
+		pflag.Float64("search.max-cost", 0, "The highest planner cost estimate (from EXPLAIN) of a trace search that is run; costlier searches are rejected (0 disables the estimate)")
+		pflag.Float64("readiness.max-pool-utilization", 0, "The share of pool connections in use (0-1) at which the plugin is no longer ready; 0 disables the check, as a pool filling up during a burst would otherwise take the replica out of rotation")
+		pflag.Int64("readiness.max-pending-writes", 1000, "The number of spans being written above which the plugin is no longer ready; 0 disables the check")
+		pflag.Bool("maintenance.enabled", false, "Whether to periodically vacuum and reindex the database and publish bloat metrics")
+		pflag.Duration("maintenance.vacuum-interval", time.Hour*6, "How often to run VACUUM (ANALYZE) on the spans, services and operations tables (0 disables)")
+		pflag.Duration("maintenance.reindex-interval", 0, "How often to run REINDEX CONCURRENTLY on the spans, services and operations tables (0 disables)")
+		pflag.Duration("maintenance.stats-interval", time.Minute, "How often to refresh the dead tuple, bloat and autovacuum metrics (0 disables)")
 
 		v := viper.New()
 		v.SetEnvPrefix("JAEGER_POSTGRESQL")
@@ -254,20 +965,35 @@ func ProvideConfig() func() (Config, error) {
 			_, ok2 := err.(viper.ConfigFileNotFoundError)
 
 			if !ok && !ok2 {
-				return cfg, fmt.Errorf("failed to read in config: %w", err)
+				return cfg, nil, fmt.Errorf("failed to read in config: %w", err)
 			}
 		}
 
 		err := v.Unmarshal(&cfg)
 		if err != nil {
-			return cfg, fmt.Errorf("failed to decode configuration: %w", err)
+			return cfg, nil, fmt.Errorf("failed to decode configuration: %w", err)
+		}
+
+		switch cfg.Mode {
+		case modeReadWrite, modeReadOnly, modeIngestionOnly:
+		default:
+			return cfg, nil, fmt.Errorf("invalid mode: %q", cfg.Mode)
 		}
 
-		return cfg, nil
+		return cfg, v, nil
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	fx.New(
 		fx.WithLogger(func(logger *slog.Logger) fxevent.Logger {
 			return &fxevent.SlogLogger{Logger: logger.With("component", "uber/fx")}
@@ -275,24 +1001,99 @@ func main() {
 		fx.Provide(
 			ProvideConfig(),
 			ProvideLogger(),
+			ProvideTracerProvider(),
+			ProvideSlowQueryLog(),
 			ProvidePgxPool(),
+			ProvideCipher(),
 			ProvideSpanStoreReader(),
+			ProvideQuotaEnforcer(),
+			ProvideRedactor(),
+			ProvideWriter(),
 			ProvideSpanStoreWriter(),
+			ProvideCanary(),
 			ProvideDependencyStoreReader(),
 			ProvideHandler(),
 			ProvideGRPCServer(),
+			ProvideReadiness(),
 			ProvideAdminServer(),
 		),
+		fx.Invoke(func(mux *http.ServeMux, readiness *Readiness, logger *slog.Logger) {
+			mux.Handle("/metrics", promhttp.Handler())
+			mux.Handle("/livez", livezHandler())
+			mux.Handle("/readyz", readyzHandler(readiness, logger))
+
+			// kept for existing probes, same as /readyz
+			mux.Handle("/", readyzHandler(readiness, logger))
+		}),
 		fx.Invoke(func(srv *grpc.Server, handler *shared.GRPCHandler) error {
 			return handler.Register(srv)
 		}),
-		fx.Invoke(func(conn *pgxpool.Pool, logger *slog.Logger, lc fx.Lifecycle) {
+		fx.Invoke(func(v *viper.Viper, quotas *store.QuotaEnforcer, logger *slog.Logger) {
+			if _, err := os.Stat(v.ConfigFileUsed()); err != nil {
+				return
+			}
+
+			// reload the parts of the config that can change at runtime
+			v.OnConfigChange(func(e fsnotify.Event) {
+				var cfg Config
+				if err := v.Unmarshal(&cfg); err != nil {
+					logger.Error("failed to decode reloaded configuration", "err", err)
+					return
+				}
+
+				quotas.SetConfig(cfg.quotaConfig())
+				logger.Info("reloaded configuration", "file", e.Name)
+			})
+			v.WatchConfig()
+		}),
+		fx.Invoke(func(cfg Config, pools Pools, logger *slog.Logger, lc fx.Lifecycle) {
+			if cfg.Stats.Interval <= 0 || pools.Write == nil {
+				return
+			}
+
 			ctx, cancelFn := context.WithCancel(context.Background())
-			lc.Append(fx.StopHook(cancelFn))
+			done := make(chan struct{})
+			lc.Append(fx.StopHook(func() {
+				cancelFn()
+				<-done
+			}))
+
+			var opts []stats.Option
+			if cfg.Database.PgBouncer {
+				// the session level lock that elects the collector is not
+				// reliable when the session may move between server connections
+				logger.Warn("collecting stats on every replica through pgbouncer")
+				opts = append(opts, stats.WithoutElection())
+			}
+
+			collector := stats.NewCollector(pools.Write, logger.With("component", "stats"), opts...)
+			collector.Register("tables", stats.TableStats())
+			collector.Register("indexes", stats.IndexStats())
 
 			go func() {
-				q := sql.New(conn)
-				ticker := time.NewTicker(time.Second * 5)
+				defer close(done)
+				collector.Run(ctx, cfg.Stats.Interval)
+			}()
+		}),
+		fx.Invoke(func(cfg Config, writer *store.Writer, logger *slog.Logger, lc fx.Lifecycle) {
+			if cfg.Usage.FlushInterval <= 0 || writer == nil {
+				return
+			}
+
+			ctx, cancelFn := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			lc.Append(fx.StopHook(func(ctx context.Context) error {
+				cancelFn()
+				<-done
+
+				// flush whatever was written since the last tick
+				return writer.FlushUsage(ctx)
+			}))
+
+			go func() {
+				defer close(done)
+
+				ticker := time.NewTicker(cfg.Usage.FlushInterval)
 				defer ticker.Stop()
 
 				for {
@@ -300,39 +1101,65 @@ func main() {
 					case <-ctx.Done():
 						return
 					case <-ticker.C:
-						byteCount, err := q.GetSpansDiskSize(ctx)
-						if err != nil {
-							logger.Error("failed to query for disk size", "err", err)
-							continue
-						} else {
-							spansTableDiskSizeGuage.Set(float64(byteCount))
-						}
-
-						count, err := q.GetSpansCount(ctx)
-						if err != nil {
-							logger.Error("failed to query for span count", "err", err)
-							continue
-						} else {
-							spansGuage.Set(float64(count))
+						if err := writer.FlushUsage(ctx); err != nil {
+							logger.Error("failed to flush service usage", "err", err)
 						}
-
 					}
 				}
 			}()
 		}),
-		fx.Invoke(func(mux *http.ServeMux, conn *pgxpool.Pool) {
-			mux.Handle("/metrics", promhttp.Handler())
-			mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				ctx, cancelFn := context.WithTimeout(r.Context(), time.Second*5)
-				defer cancelFn()
+		fx.Invoke(func(cfg Config, pools Pools, logger *slog.Logger, lc fx.Lifecycle) {
+			if !cfg.Maintenance.Enabled || pools.Write == nil {
+				return
+			}
 
-				err := conn.Ping(ctx)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-				}
+			ctx, cancelFn := context.WithCancel(context.Background())
+			lc.Append(fx.StopHook(cancelFn))
+
+			m := maintenance.New(sql.New(pools.Write), logger.With("component", "maintenance"))
+			go m.Run(ctx, maintenance.Config{
+				VacuumInterval:  cfg.Maintenance.VacuumInterval,
+				ReindexInterval: cfg.Maintenance.ReindexInterval,
+				StatsInterval:   cfg.Maintenance.StatsInterval,
+			})
+		}),
+		fx.Invoke(func(cfg Config, v *viper.Viper, pools Pools, mux *http.ServeMux, logger *slog.Logger) {
+			mux.Handle("/status", statusHandler(cfg, v, pools, logger))
+		}),
+		fx.Invoke(func(slowLog *slowquery.Log, mux *http.ServeMux, logger *slog.Logger) {
+			if slowLog == nil {
+				return
+			}
+
+			mux.Handle("/debug/slow-queries", slowQueriesHandler(slowLog, logger))
+		}),
+		fx.Invoke(func(cfg Config, canary *store.Canary, lc fx.Lifecycle) {
+			if canary == nil {
+				return
+			}
 
-				w.WriteHeader(http.StatusOK)
+			ctx, cancelFn := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			lc.Append(fx.StartStopHook(
+				func() {
+					go func() {
+						defer close(done)
+						canary.Run(ctx, cfg.Canary.Interval)
+					}()
+				},
+				func() {
+					cancelFn()
+					<-done
+				},
+			))
+		}),
+		fx.Invoke(func(lc fx.Lifecycle, cfg Config, pools Pools, writer *store.Writer, canary *store.Canary, readiness *Readiness) {
+			// hooks run in the order they were appended, so this runs once
+			// the servers are started
+			lc.Append(fx.StartHook(func() {
+				readiness.Ready(readinessChecks(cfg, pools, writer, canary)...)
 			}))
 		}),
+		fx.Invoke(RegisterHealth()),
 	).Run()
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolsPrimary(t *testing.T) {
+	// the pools connect lazily, so no database is needed
+	newPool := func() *pgxpool.Pool {
+		pool, err := pgxpool.New(context.Background(), "postgres://localhost:5432/jaeger")
+		require.Nil(t, err)
+		t.Cleanup(pool.Close)
+		return pool
+	}
+
+	read, write := newPool(), newPool()
+
+	t.Run("should prefer the write pool", func(t *testing.T) {
+		require.Same(t, write, Pools{Read: read, Write: write}.primary())
+	})
+
+	t.Run("should use the write pool in ingestion-only mode", func(t *testing.T) {
+		require.Same(t, write, Pools{Write: write}.primary())
+	})
+
+	// row level security checks the role on the primary pool, which must
+	// exist without a write pool
+	t.Run("should use the read pool in read-only mode", func(t *testing.T) {
+		require.Same(t, read, Pools{Read: read}.primary())
+	})
+}
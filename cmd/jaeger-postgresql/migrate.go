@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/spf13/pflag"
+)
+
+const migrateUsage = `usage: jaeger-postgresql migrate <command> [flags]
+
+commands:
+  status            show whether each migration is applied
+  up                apply all pending migrations
+  up-to VERSION     apply the pending migrations up to VERSION
+  down              roll back the latest migration
+  down-to VERSION   roll back the migrations newer than VERSION
+  version           show the database and latest known schema versions`
+
+// runMigrate runs the migrate command against the configured database, with
+// the migrations embedded in the binary.
+func runMigrate() error {
+	cfg, _, err := ProvideConfig()()
+	if err != nil {
+		return err
+	}
+
+	// the first argument is "migrate" itself
+	args := pflag.Args()[1:]
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	// report to stdout regardless of the configured log level
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	migrationURL, opts := migrationTarget(cfg, logger)
+	if migrationURL == "" {
+		return fmt.Errorf("invalid database url")
+	}
+
+	version := func() (int64, error) {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("%s requires a version\n\n%s", args[0], migrateUsage)
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+
+		return version, nil
+	}
+
+	switch args[0] {
+	case "status":
+		return sql.MigrationStatus(logger, migrationURL, opts...)
+	case "up":
+		return sql.Migrate(logger, migrationURL, opts...)
+	case "up-to":
+		version, err := version()
+		if err != nil {
+			return err
+		}
+
+		return sql.MigrateUpTo(logger, migrationURL, version, opts...)
+	case "down":
+		return sql.MigrateDown(logger, migrationURL, opts...)
+	case "down-to":
+		version, err := version()
+		if err != nil {
+			return err
+		}
+
+		return sql.MigrateDownTo(logger, migrationURL, version, opts...)
+	case "version":
+		current, latest, err := sql.MigrationVersions(logger, migrationURL, opts...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("database version: %d\nlatest known version: %d\n", current, latest)
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/slowquery"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/stats"
+	"github.com/spf13/viper"
+)
+
+// version is the version of the build, set with
+// -ldflags "-X main.version=...". Without it the vcs revision is used.
+var version string
+
+// buildVersion returns the version of the running binary.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+
+	return info.Main.Version
+}
+
+// secretMask replaces secrets, the same as url.URL.Redacted does.
+const secretMask = "xxxxx"
+
+var (
+	// secretKeyPattern matches the config keys whose values are masked.
+	secretKeyPattern = regexp.MustCompile(`(?i)(password|secret|token)`)
+
+	// dsnPasswordPattern matches the password of a keyword/value connection
+	// string, e.g. "host=db password=secret".
+	dsnPasswordPattern = regexp.MustCompile(`password=('(\\.|[^'])*'|\S+)`)
+)
+
+// maskSettings returns a copy of the settings with secrets masked, i.e. the
+// passwords of database urls and the values of keys that look like secrets.
+func maskSettings(settings map[string]any) map[string]any {
+	masked := make(map[string]any, len(settings))
+	for key, value := range settings {
+		switch value := value.(type) {
+		case map[string]any:
+			masked[key] = maskSettings(value)
+		case string:
+			switch {
+			case value == "":
+				masked[key] = value
+			case secretKeyPattern.MatchString(key):
+				masked[key] = secretMask
+			case strings.HasSuffix(key, "url"):
+				masked[key] = maskURL(value)
+			default:
+				masked[key] = value
+			}
+		default:
+			masked[key] = value
+		}
+	}
+
+	return masked
+}
+
+// maskURL masks the password of a postgres connection string, in either the
+// url or the keyword/value format.
+func maskURL(connStr string) string {
+	u, err := url.Parse(connStr)
+	if err != nil || u.Scheme == "" {
+		return dsnPasswordPattern.ReplaceAllString(connStr, "password="+secretMask)
+	}
+
+	query := u.Query()
+	if query.Has("password") {
+		query.Set("password", secretMask)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.Redacted()
+}
+
+// tableStatus is the size of a table on the status page.
+type tableStatus struct {
+	Name         string `json:"name"`
+	RowEstimate  int64  `json:"row_estimate"`
+	TableBytes   int64  `json:"table_bytes"`
+	IndexesBytes int64  `json:"indexes_bytes"`
+	TotalBytes   int64  `json:"total_bytes"`
+}
+
+// statusHandler serves a summary of the build, config and database as json,
+// for humans debugging a deployment.
+func statusHandler(cfg Config, v *viper.Viper, pools Pools, logger *slog.Logger) http.Handler {
+	// the read pool is preferred, the status page only reads
+	pool := pools.Read
+	if pool == nil {
+		pool = pools.Write
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancelFn := context.WithTimeout(r.Context(), time.Second*5)
+		defer cancelFn()
+
+		type schemaStatus struct {
+			Version int64  `json:"version"`
+			Latest  int64  `json:"latest"`
+			Error   string `json:"error,omitempty"`
+		}
+
+		response := struct {
+			Version     string         `json:"version"`
+			Mode        string         `json:"mode"`
+			Config      map[string]any `json:"config"`
+			Schema      schemaStatus   `json:"schema"`
+			Tables      []tableStatus  `json:"tables"`
+			TablesError string         `json:"tables_error,omitempty"`
+		}{
+			Version: buildVersion(),
+			Mode:    cfg.Mode,
+			Config:  maskSettings(v.AllSettings()),
+		}
+
+		// a failing query is reported on the page rather than failing it, the
+		// rest of it is still useful
+		q := sql.New(pool)
+
+		latest, err := sql.LatestMigration()
+		if err == nil {
+			response.Schema.Latest = latest
+			response.Schema.Version, err = q.GetSchemaVersion(ctx)
+		}
+		if err != nil {
+			response.Schema.Error = err.Error()
+		}
+
+		tables, err := q.GetTableStats(ctx, stats.Tables)
+		if err != nil {
+			response.TablesError = err.Error()
+		}
+
+		for _, table := range tables {
+			response.Tables = append(response.Tables, tableStatus{
+				Name:         table.TableName,
+				RowEstimate:  table.RowEstimate,
+				TableBytes:   table.TableBytes,
+				IndexesBytes: table.IndexesBytes,
+				TotalBytes:   table.TotalBytes,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(response); err != nil {
+			logger.Error("failed to write status response", "err", err)
+		}
+	})
+}
+
+// slowQueriesHandler serves the latest slow queries as json, with their plans
+// when they are captured for the endpoint.
+func slowQueriesHandler(slowLog *slowquery.Log, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(slowLog.Entries()); err != nil {
+			logger.Error("failed to write slow queries response", "err", err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package dbpool
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultMaxConns is used when no maximum number of connections is set.
+	DefaultMaxConns = 20
+
+	// DefaultConnectTimeout is used when no connect timeout is set.
+	DefaultConnectTimeout = time.Second * 10
+
+	// PgBouncerQueryExecMode is the query exec mode used behind PgBouncer. It
+	// uses the extended protocol with unnamed prepared statements, which do
+	// not need to outlive the transaction.
+	PgBouncerQueryExecMode = pgx.QueryExecModeExec
+)
+
+// Config configures a connection pool. Apart from MaxConns and
+// ConnectTimeout, zero values keep the pgx and postgres defaults.
+type Config struct {
+	MaxConns          int           `mapstructure:"max-conns"`
+	MinConns          int           `mapstructure:"min-conns"`
+	ConnectTimeout    time.Duration `mapstructure:"connect-timeout"`
+	MaxConnLifetime   time.Duration `mapstructure:"max-conn-lifetime"`
+	MaxConnIdleTime   time.Duration `mapstructure:"max-conn-idle-time"`
+	HealthCheckPeriod time.Duration `mapstructure:"health-check-period"`
+
+	// StatementTimeout and LockTimeout are set as run-time parameters of
+	// every connection, so they apply to every query.
+	StatementTimeout time.Duration `mapstructure:"statement-timeout"`
+	LockTimeout      time.Duration `mapstructure:"lock-timeout"`
+
+	// ApplicationName shows up in pg_stat_activity and the server logs.
+	ApplicationName string `mapstructure:"application-name"`
+
+	// PgBouncer makes the pool usable behind PgBouncer in transaction
+	// pooling mode, where consecutive transactions may run on different
+	// server connections and named prepared statements cannot be used.
+	PgBouncer bool `mapstructure:"pgbouncer"`
+}
+
+// Apply sets the options on the pgx pool config.
+func (c Config) Apply(pgxconfig *pgxpool.Config) {
+	pgxconfig.MaxConns = DefaultMaxConns
+	if c.MaxConns > 0 {
+		pgxconfig.MaxConns = int32(c.MaxConns)
+	}
+
+	if c.MinConns > 0 {
+		pgxconfig.MinConns = int32(c.MinConns)
+	}
+
+	pgxconfig.ConnConfig.ConnectTimeout = DefaultConnectTimeout
+	if c.ConnectTimeout > 0 {
+		pgxconfig.ConnConfig.ConnectTimeout = c.ConnectTimeout
+	}
+
+	if c.MaxConnLifetime > 0 {
+		pgxconfig.MaxConnLifetime = c.MaxConnLifetime
+	}
+
+	if c.MaxConnIdleTime > 0 {
+		pgxconfig.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+
+	if c.HealthCheckPeriod > 0 {
+		pgxconfig.HealthCheckPeriod = c.HealthCheckPeriod
+	}
+
+	if c.PgBouncer {
+		pgxconfig.ConnConfig.DefaultQueryExecMode = PgBouncerQueryExecMode
+	}
+
+	params := pgxconfig.ConnConfig.RuntimeParams
+	if c.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if c.LockTimeout > 0 {
+		params["lock_timeout"] = strconv.FormatInt(c.LockTimeout.Milliseconds(), 10)
+	}
+
+	if c.ApplicationName != "" {
+		params["application_name"] = c.ApplicationName
+	}
+}
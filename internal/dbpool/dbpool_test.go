@@ -0,0 +1,62 @@
+package dbpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	parse := func(t *testing.T) *pgxpool.Config {
+		pgxconfig, err := pgxpool.ParseConfig("postgres://localhost/jaeger")
+		require.Nil(t, err)
+
+		return pgxconfig
+	}
+
+	t.Run("should apply the defaults", func(t *testing.T) {
+		pgxconfig := parse(t)
+		Config{}.Apply(pgxconfig)
+
+		require.Equal(t, int32(DefaultMaxConns), pgxconfig.MaxConns)
+		require.Equal(t, DefaultConnectTimeout, pgxconfig.ConnConfig.ConnectTimeout)
+		require.NotContains(t, pgxconfig.ConnConfig.RuntimeParams, "statement_timeout")
+		require.NotContains(t, pgxconfig.ConnConfig.RuntimeParams, "lock_timeout")
+		require.Equal(t, pgx.QueryExecModeCacheStatement, pgxconfig.ConnConfig.DefaultQueryExecMode)
+	})
+
+	t.Run("should avoid named prepared statements behind pgbouncer", func(t *testing.T) {
+		pgxconfig := parse(t)
+		Config{PgBouncer: true}.Apply(pgxconfig)
+
+		require.Equal(t, PgBouncerQueryExecMode, pgxconfig.ConnConfig.DefaultQueryExecMode)
+	})
+
+	t.Run("should apply the options", func(t *testing.T) {
+		pgxconfig := parse(t)
+		Config{
+			MaxConns:          5,
+			MinConns:          2,
+			ConnectTimeout:    time.Second * 3,
+			MaxConnLifetime:   time.Minute * 10,
+			MaxConnIdleTime:   time.Minute * 2,
+			HealthCheckPeriod: time.Second * 15,
+			StatementTimeout:  time.Second * 30,
+			LockTimeout:       time.Millisecond * 1500,
+			ApplicationName:   "jaeger",
+		}.Apply(pgxconfig)
+
+		require.Equal(t, int32(5), pgxconfig.MaxConns)
+		require.Equal(t, int32(2), pgxconfig.MinConns)
+		require.Equal(t, time.Second*3, pgxconfig.ConnConfig.ConnectTimeout)
+		require.Equal(t, time.Minute*10, pgxconfig.MaxConnLifetime)
+		require.Equal(t, time.Minute*2, pgxconfig.MaxConnIdleTime)
+		require.Equal(t, time.Second*15, pgxconfig.HealthCheckPeriod)
+		require.Equal(t, "30000", pgxconfig.ConnConfig.RuntimeParams["statement_timeout"])
+		require.Equal(t, "1500", pgxconfig.ConnConfig.RuntimeParams["lock_timeout"])
+		require.Equal(t, "jaeger", pgxconfig.ConnConfig.RuntimeParams["application_name"])
+	})
+}
@@ -0,0 +1,139 @@
+package dbpool
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const promNamespace = "jaeger_postgresql"
+
+var (
+	promAcquiredConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "acquired_conns"),
+		"The number of connections currently acquired from the pool",
+		[]string{"pool"}, nil,
+	)
+
+	promIdleConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "idle_conns"),
+		"The number of idle connections in the pool",
+		[]string{"pool"}, nil,
+	)
+
+	promConstructingConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "constructing_conns"),
+		"The number of connections being established",
+		[]string{"pool"}, nil,
+	)
+
+	promTotalConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "total_conns"),
+		"The total number of connections in the pool",
+		[]string{"pool"}, nil,
+	)
+
+	promMaxConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "max_conns"),
+		"The maximum number of connections in the pool",
+		[]string{"pool"}, nil,
+	)
+
+	promAcquiresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "acquires_total"),
+		"The total number of successful connection acquires",
+		[]string{"pool"}, nil,
+	)
+
+	promAcquireSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "acquire_seconds_total"),
+		"The total time spent acquiring connections",
+		[]string{"pool"}, nil,
+	)
+
+	promEmptyAcquiresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "empty_acquires_total"),
+		"The total number of acquires that had to wait for a connection because the pool was empty",
+		[]string{"pool"}, nil,
+	)
+
+	promCanceledAcquiresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "canceled_acquires_total"),
+		"The total number of acquires canceled by their context",
+		[]string{"pool"}, nil,
+	)
+
+	promNewConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "new_conns_total"),
+		"The total number of connections opened",
+		[]string{"pool"}, nil,
+	)
+
+	promMaxLifetimeDestroysDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "max_lifetime_destroys_total"),
+		"The total number of connections closed because they exceeded the max connection lifetime",
+		[]string{"pool"}, nil,
+	)
+
+	promMaxIdleDestroysDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(promNamespace, "pool", "max_idle_destroys_total"),
+		"The total number of connections closed because they exceeded the max connection idle time",
+		[]string{"pool"}, nil,
+	)
+)
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// Collector exports the statistics of a pool. They are read when the metrics
+// are scraped.
+type Collector struct {
+	name string
+	pool *pgxpool.Pool
+}
+
+// NewCollector returns a collector for the pool, labelling its metrics with
+// the pool name.
+func NewCollector(name string, pool *pgxpool.Pool) *Collector {
+	return &Collector{name: name, pool: pool}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- promAcquiredConnsDesc
+	ch <- promIdleConnsDesc
+	ch <- promConstructingConnsDesc
+	ch <- promTotalConnsDesc
+	ch <- promMaxConnsDesc
+	ch <- promAcquiresDesc
+	ch <- promAcquireSecondsDesc
+	ch <- promEmptyAcquiresDesc
+	ch <- promCanceledAcquiresDesc
+	ch <- promNewConnsDesc
+	ch <- promMaxLifetimeDestroysDesc
+	ch <- promMaxIdleDestroysDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, c.name)
+	}
+
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, c.name)
+	}
+
+	gauge(promAcquiredConnsDesc, float64(stat.AcquiredConns()))
+	gauge(promIdleConnsDesc, float64(stat.IdleConns()))
+	gauge(promConstructingConnsDesc, float64(stat.ConstructingConns()))
+	gauge(promTotalConnsDesc, float64(stat.TotalConns()))
+	gauge(promMaxConnsDesc, float64(stat.MaxConns()))
+	counter(promAcquiresDesc, float64(stat.AcquireCount()))
+	counter(promAcquireSecondsDesc, stat.AcquireDuration().Seconds())
+	counter(promEmptyAcquiresDesc, float64(stat.EmptyAcquireCount()))
+	counter(promCanceledAcquiresDesc, float64(stat.CanceledAcquireCount()))
+	counter(promNewConnsDesc, float64(stat.NewConnsCount()))
+	counter(promMaxLifetimeDestroysDesc, float64(stat.MaxLifetimeDestroyCount()))
+	counter(promMaxIdleDestroysDesc, float64(stat.MaxIdleDestroyCount()))
+}
@@ -0,0 +1,81 @@
+package dbpool
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+)
+
+// TenantSetter sets the tenant that row level security policies allow a
+// pooled connection to see to the tenant of the request it is acquired for.
+//
+// The tenant is a session setting, as the queries run in implicit transactions
+// of their own, so setting it costs a round trip. Each connection remembers its
+// tenant, and it is only set again when the connection is acquired for another
+// tenant, which for a few busy tenants is rare. BenchmarkTenantSetter measures
+// both cases.
+type TenantSetter struct {
+	logger *slog.Logger
+
+	// set sets the tenant of the connection
+	set func(ctx context.Context, conn *pgx.Conn, tenant string) error
+
+	mu      sync.Mutex
+	tenants map[*pgx.Conn]string
+}
+
+// NewTenantSetter returns a TenantSetter.
+func NewTenantSetter(logger *slog.Logger) *TenantSetter {
+	return &TenantSetter{
+		logger: logger,
+		set: func(ctx context.Context, conn *pgx.Conn, tenant string) error {
+			return sql.New(conn).SetTenant(ctx, tenant)
+		},
+		tenants: map[*pgx.Conn]string{},
+	}
+}
+
+// BeforeAcquire sets the tenant of the connection, if it is not set to it
+// already. It is meant for pgxpool.Config.BeforeAcquire, and rejects the
+// connection if the tenant cannot be set.
+func (s *TenantSetter) BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	tenant := tenancy.GetTenant(ctx)
+
+	s.mu.Lock()
+	current, ok := s.tenants[conn]
+	s.mu.Unlock()
+
+	if ok && current == tenant {
+		return true
+	}
+
+	if err := s.set(ctx, conn, tenant); err != nil {
+		s.logger.Error("failed to set connection tenant", "err", err)
+
+		s.forget(conn)
+		return false
+	}
+
+	s.mu.Lock()
+	s.tenants[conn] = tenant
+	s.mu.Unlock()
+
+	return true
+}
+
+// BeforeClose forgets the tenant of the connection. It is meant for
+// pgxpool.Config.BeforeClose.
+func (s *TenantSetter) BeforeClose(conn *pgx.Conn) {
+	s.forget(conn)
+}
+
+func (s *TenantSetter) forget(conn *pgx.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tenants, conn)
+}
@@ -0,0 +1,108 @@
+package dbpool
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sqltest"
+	"github.com/jackc/pgx/v5"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantSetter(t *testing.T) {
+	acme := tenancy.WithTenant(context.Background(), "acme")
+	globex := tenancy.WithTenant(context.Background(), "globex")
+
+	// newSetter returns a setter that records the tenants it sets instead of
+	// querying the connection
+	newSetter := func(err error) (*TenantSetter, *[]string) {
+		var set []string
+
+		s := NewTenantSetter(slog.Default())
+		s.set = func(ctx context.Context, conn *pgx.Conn, tenant string) error {
+			set = append(set, tenant)
+			return err
+		}
+
+		return s, &set
+	}
+
+	t.Run("should only set the tenant when it changes", func(t *testing.T) {
+		s, set := newSetter(nil)
+		conn := &pgx.Conn{}
+
+		require.True(t, s.BeforeAcquire(acme, conn))
+		require.True(t, s.BeforeAcquire(acme, conn))
+		require.True(t, s.BeforeAcquire(globex, conn))
+		require.True(t, s.BeforeAcquire(globex, conn))
+
+		require.Equal(t, []string{"acme", "globex"}, *set)
+	})
+
+	t.Run("should set the tenant of each connection", func(t *testing.T) {
+		s, set := newSetter(nil)
+
+		require.True(t, s.BeforeAcquire(acme, &pgx.Conn{}))
+		require.True(t, s.BeforeAcquire(acme, &pgx.Conn{}))
+
+		require.Equal(t, []string{"acme", "acme"}, *set)
+	})
+
+	t.Run("should set the tenant again after a failure", func(t *testing.T) {
+		s, set := newSetter(errors.New("connection reset"))
+		conn := &pgx.Conn{}
+
+		require.False(t, s.BeforeAcquire(acme, conn))
+		require.False(t, s.BeforeAcquire(acme, conn))
+
+		require.Equal(t, []string{"acme", "acme"}, *set)
+	})
+
+	t.Run("should forget closed connections", func(t *testing.T) {
+		s, set := newSetter(nil)
+		conn := &pgx.Conn{}
+
+		require.True(t, s.BeforeAcquire(acme, conn))
+		s.BeforeClose(conn)
+		require.NotContains(t, s.tenants, conn)
+
+		require.True(t, s.BeforeAcquire(acme, conn))
+		require.Equal(t, []string{"acme", "acme"}, *set)
+	})
+}
+
+func BenchmarkTenantSetter(b *testing.B) {
+	conn, _, closer := sqltest.Harness(b)
+	defer closer.Close()
+
+	acme := tenancy.WithTenant(context.Background(), "acme")
+	globex := tenancy.WithTenant(context.Background(), "globex")
+
+	// a connection acquired by the same tenant again costs no round trip
+	b.Run("same tenant", func(b *testing.B) {
+		s := NewTenantSetter(slog.Default())
+		for i := 0; i < b.N; i++ {
+			if !s.BeforeAcquire(acme, conn) {
+				b.Fatal("failed to set tenant")
+			}
+		}
+	})
+
+	// a connection acquired by alternating tenants costs a round trip each
+	b.Run("alternating tenants", func(b *testing.B) {
+		s := NewTenantSetter(slog.Default())
+		for i := 0; i < b.N; i++ {
+			ctx := acme
+			if i%2 == 1 {
+				ctx = globex
+			}
+
+			if !s.BeforeAcquire(ctx, conn) {
+				b.Fatal("failed to set tenant")
+			}
+		}
+	})
+}
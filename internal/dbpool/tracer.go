@@ -0,0 +1,30 @@
+package dbpool
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryTracers combines query tracers, as a connection takes a single one.
+type QueryTracers []pgx.QueryTracer
+
+var _ pgx.QueryTracer = QueryTracers(nil)
+
+// TraceQueryStart implements pgx.QueryTracer, passing the context returned by
+// each tracer on to the next.
+func (t QueryTracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, tracer := range t {
+		ctx = tracer.TraceQueryStart(ctx, conn, data)
+	}
+
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer, in the reverse order of
+// TraceQueryStart.
+func (t QueryTracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for i := len(t) - 1; i >= 0; i-- {
+		t[i].TraceQueryEnd(ctx, conn, data)
+	}
+}
@@ -0,0 +1,173 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// keyfile is the on-disk format of the keys, e.g.
+//
+//	{
+//	  "active": "2024-06",
+//	  "keys": {"2024-05": "<base64>", "2024-06": "<base64>"},
+//	  "index_key": "<base64>"
+//	}
+//
+// Every key is a base64 encoded AES-256 key. New values are encrypted with the
+// active key; the other keys are kept to decrypt values written before a
+// rotation. The index key derives the blind indexes used for searching, and
+// unlike the encryption keys it cannot be rotated without rewriting the data.
+type keyfile struct {
+	Active   string            `json:"active"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// Cipher encrypts and decrypts the values of selected tag keys.
+type Cipher struct {
+	tagKeys  map[string]struct{}
+	active   string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// Load reads the keyfile at path and returns a Cipher that encrypts the
+// values of the given tag keys.
+func Load(path string, tagKeys []string) (*Cipher, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+
+	var kf keyfile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, fmt.Errorf("failed to decode keyfile: %w", err)
+	}
+
+	return newCipher(kf, tagKeys)
+}
+
+func newCipher(kf keyfile, tagKeys []string) (*Cipher, error) {
+	c := &Cipher{
+		tagKeys: make(map[string]struct{}, len(tagKeys)),
+		active:  kf.Active,
+		aeads:   make(map[string]cipher.AEAD, len(kf.Keys)),
+	}
+
+	for _, tagKey := range tagKeys {
+		c.tagKeys[tagKey] = struct{}{}
+	}
+
+	for id, encoded := range kf.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id: %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %s: %w", id, err)
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, got %d", id, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher for key %s: %w", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gcm for key %s: %w", id, err)
+		}
+
+		c.aeads[id] = aead
+	}
+
+	if _, ok := c.aeads[c.active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyfile", c.active)
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(kf.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode index key: %w", err)
+	}
+
+	if len(indexKey) < 32 {
+		return nil, fmt.Errorf("index key must be at least 32 bytes, got %d", len(indexKey))
+	}
+
+	c.indexKey = indexKey
+	return c, nil
+}
+
+// Encrypts reports whether values of the tag key are encrypted.
+func (c *Cipher) Encrypts(tagKey string) bool {
+	_, ok := c.tagKeys[tagKey]
+	return ok
+}
+
+// Encrypt encrypts the value of a tag with the active key. The result is
+// prefixed with the key id so that it can be decrypted after a rotation. The
+// tag key is authenticated so that a value cannot be moved to another tag.
+func (c *Cipher) Encrypt(tagKey string, value string) (string, error) {
+	aead := c.aeads[c.active]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(tagKey))
+	return c.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt, using whichever key the value was encrypted with.
+func (c *Cipher) Decrypt(tagKey string, ciphertext string) (string, error) {
+	id, encoded, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return "", fmt.Errorf("ciphertext has no key id")
+	}
+
+	aead, ok := c.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("unknown key id: %s", id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(tagKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// BlindIndex returns a keyed hash of the tag value. It is stored in place of
+// the plaintext so that exact-match searches can compare blind indexes
+// without the plaintext ever being stored.
+func (c *Cipher) BlindIndex(tagKey string, value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(tagKey))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
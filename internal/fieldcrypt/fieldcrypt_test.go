@@ -0,0 +1,82 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestCipher(t *testing.T) {
+	c, err := newCipher(keyfile{
+		Active:   "k1",
+		Keys:     map[string]string{"k1": testKey('a')},
+		IndexKey: testKey('i'),
+	}, []string{"customer.id"})
+	require.Nil(t, err)
+
+	t.Run("should only encrypt configured tags", func(t *testing.T) {
+		require.True(t, c.Encrypts("customer.id"))
+		require.False(t, c.Encrypts("http.method"))
+	})
+
+	t.Run("should round trip a value", func(t *testing.T) {
+		ciphertext, err := c.Encrypt("customer.id", "1234")
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(ciphertext, "k1:"))
+		require.NotContains(t, ciphertext, "1234")
+
+		plaintext, err := c.Decrypt("customer.id", ciphertext)
+		require.Nil(t, err)
+		require.Equal(t, "1234", plaintext)
+	})
+
+	t.Run("should not decrypt a value moved to another tag", func(t *testing.T) {
+		ciphertext, err := c.Encrypt("customer.id", "1234")
+		require.Nil(t, err)
+
+		_, err = c.Decrypt("user.id", ciphertext)
+		require.Error(t, err)
+	})
+
+	t.Run("should decrypt values encrypted before a rotation", func(t *testing.T) {
+		ciphertext, err := c.Encrypt("customer.id", "1234")
+		require.Nil(t, err)
+
+		rotated, err := newCipher(keyfile{
+			Active:   "k2",
+			Keys:     map[string]string{"k1": testKey('a'), "k2": testKey('b')},
+			IndexKey: testKey('i'),
+		}, []string{"customer.id"})
+		require.Nil(t, err)
+
+		plaintext, err := rotated.Decrypt("customer.id", ciphertext)
+		require.Nil(t, err)
+		require.Equal(t, "1234", plaintext)
+
+		reencrypted, err := rotated.Encrypt("customer.id", "1234")
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(reencrypted, "k2:"))
+
+		require.Equal(t, c.BlindIndex("customer.id", "1234"), rotated.BlindIndex("customer.id", "1234"))
+	})
+
+	t.Run("should derive distinct blind indexes per tag", func(t *testing.T) {
+		require.Equal(t, c.BlindIndex("customer.id", "1234"), c.BlindIndex("customer.id", "1234"))
+		require.NotEqual(t, c.BlindIndex("customer.id", "1234"), c.BlindIndex("user.id", "1234"))
+	})
+
+	t.Run("should reject a missing active key", func(t *testing.T) {
+		_, err := newCipher(keyfile{
+			Active:   "k2",
+			Keys:     map[string]string{"k1": testKey('a')},
+			IndexKey: testKey('i'),
+		}, nil)
+		require.Error(t, err)
+	})
+}
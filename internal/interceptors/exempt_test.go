@@ -0,0 +1,82 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestExempt(t *testing.T) {
+	ctx := context.Background()
+
+	manager := tenancy.NewManager(&tenancy.Options{Enabled: true, Header: "x-tenant"})
+	unary := ExemptUnary(tenancy.NewGuardingUnaryInterceptor(manager), InfrastructureMethods...)
+	stream := ExemptStream(tenancy.NewGuardingStreamInterceptor(manager), InfrastructureMethods...)
+
+	// the server guards tenants the way the plugin does with tenancy enabled
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream))
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	reflection.Register(srv)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	t.Run("should check health without a tenant", func(t *testing.T) {
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Nil(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("should watch health without a tenant", func(t *testing.T) {
+		watch, err := grpc_health_v1.NewHealthClient(conn).Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Nil(t, err)
+
+		resp, err := watch.Recv()
+		require.Nil(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("should reflect without a tenant", func(t *testing.T) {
+		info, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		require.Nil(t, err)
+
+		err = info.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		require.Nil(t, err)
+
+		resp, err := info.Recv()
+		require.Nil(t, err)
+		require.NotNil(t, resp.GetListServicesResponse())
+	})
+
+	t.Run("should still guard other methods", func(t *testing.T) {
+		info := &grpc.UnaryServerInfo{FullMethod: "/jaeger.storage.v1.SpanReaderPlugin/GetServices"}
+		// the server always passes the incoming metadata, here without a tenant
+		_, err := unary(metadata.NewIncomingContext(ctx, metadata.MD{}), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
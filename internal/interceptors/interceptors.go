@@ -0,0 +1,157 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const promNamespace = "jaeger_postgresql"
+
+var (
+	promRequestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "grpc_requests_total",
+		Help:      "The total number of gRPC requests handled, by method and status code",
+	}, []string{"method", "code"})
+
+	promRequestsHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Name:      "grpc_request_seconds",
+		Help:      "The time spent handling gRPC requests, by method",
+	}, []string{"method"})
+
+	promPanicsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "grpc_panics_total",
+		Help:      "The total number of gRPC requests that panicked, by method",
+	}, []string{"method"})
+)
+
+// Observer records metrics and access logs of gRPC requests.
+type Observer struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewObserver returns an Observer that writes access logs at the level.
+func NewObserver(logger *slog.Logger, level slog.Level) *Observer {
+	return &Observer{logger: logger, level: level}
+}
+
+func (o *Observer) observe(ctx context.Context, method string, start time.Time, err error) {
+	duration := time.Since(start)
+	code := status.Code(err)
+
+	promRequestsCounter.WithLabelValues(method, code.String()).Inc()
+	promRequestsHistogram.WithLabelValues(method).Observe(duration.Seconds())
+
+	attrs := []any{"method", method, "code", code.String(), "duration", duration}
+	if err != nil {
+		attrs = append(attrs, "err", err)
+	}
+
+	o.logger.Log(ctx, o.level, "handled grpc request", attrs...)
+}
+
+// Unary returns the unary server interceptor.
+func (o *Observer) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		o.observe(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// Stream returns the stream server interceptor.
+func (o *Observer) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		o.observe(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// recovered turns a panic into a codes.Internal error, so that a single
+// request cannot take down the process.
+func recovered(logger *slog.Logger, method string, p any) error {
+	promPanicsCounter.WithLabelValues(method).Inc()
+	logger.Error("recovered from panic in grpc handler", "method", method, "panic", p, "stack", string(debug.Stack()))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// RecoverUnary returns a unary server interceptor that recovers from panics.
+func RecoverUnary(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, info.FullMethod, p)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoverStream returns a stream server interceptor that recovers from panics.
+func RecoverStream(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, info.FullMethod, p)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// InfrastructureMethods are the prefixes of the methods of the health and
+// reflection services. Probes and tools call them without request metadata,
+// such as the tenant header.
+var InfrastructureMethods = []string{"/grpc.health.v1.Health/", "/grpc.reflection."}
+
+// exempt reports whether the method starts with one of the prefixes.
+func exempt(method string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExemptUnary returns a unary server interceptor that skips the interceptor
+// for the methods starting with one of the prefixes.
+func ExemptUnary(interceptor grpc.UnaryServerInterceptor, prefixes ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if exempt(info.FullMethod, prefixes) {
+			return handler(ctx, req)
+		}
+
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// ExemptStream returns a stream server interceptor that skips the interceptor
+// for the methods starting with one of the prefixes.
+func ExemptStream(interceptor grpc.StreamServerInterceptor, prefixes ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if exempt(info.FullMethod, prefixes) {
+			return handler(srv, ss)
+		}
+
+		return interceptor(srv, ss, info, handler)
+	}
+}
@@ -0,0 +1,52 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterceptors(t *testing.T) {
+	ctx := context.Background()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	// the interceptors are chained the way the server chains them
+	observer := NewObserver(slog.Default(), slog.LevelDebug)
+	chain := func(handler grpc.UnaryHandler) (any, error) {
+		return observer.Unary()(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			return RecoverUnary(slog.Default())(ctx, req, info, handler)
+		})
+	}
+
+	t.Run("should count requests by status code", func(t *testing.T) {
+		before := testutil.ToFloat64(promRequestsCounter.WithLabelValues(info.FullMethod, codes.NotFound.String()))
+
+		_, err := chain(func(ctx context.Context, req any) (any, error) {
+			return nil, status.Error(codes.NotFound, "not found")
+		})
+		require.Equal(t, codes.NotFound, status.Code(err))
+
+		after := testutil.ToFloat64(promRequestsCounter.WithLabelValues(info.FullMethod, codes.NotFound.String()))
+		require.Equal(t, before+1, after)
+	})
+
+	t.Run("should recover from panics", func(t *testing.T) {
+		before := testutil.ToFloat64(promRequestsCounter.WithLabelValues(info.FullMethod, codes.Internal.String()))
+
+		_, err := chain(func(ctx context.Context, req any) (any, error) {
+			panic(errors.New("corrupt span"))
+		})
+		require.Equal(t, codes.Internal, status.Code(err))
+
+		after := testutil.ToFloat64(promRequestsCounter.WithLabelValues(info.FullMethod, codes.Internal.String()))
+		require.Equal(t, before+1, after)
+		require.Equal(t, float64(1), testutil.ToFloat64(promPanicsCounter.WithLabelValues(info.FullMethod)))
+	})
+}
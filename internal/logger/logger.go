@@ -6,6 +6,22 @@ import (
 	"os"
 )
 
+// ParseLevel parses one of the log levels debug, info, warn and error.
+func ParseLevel(level string) (slog.Level, error) {
+	switch level {
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	default:
+		return 0, fmt.Errorf("invalid log level: %s", level)
+	}
+}
+
 // New returns a new logger.
 func New(loglevelStr *string) (*slog.Logger, error) {
 	levelFn := func() (slog.Level, error) {
@@ -13,18 +29,7 @@ func New(loglevelStr *string) (*slog.Logger, error) {
 			return slog.LevelWarn, nil
 		}
 
-		switch *loglevelStr {
-		case "info":
-			return slog.LevelInfo, nil
-		case "warn":
-			return slog.LevelWarn, nil
-		case "error":
-			return slog.LevelError, nil
-		case "debug":
-			return slog.LevelDebug, nil
-		default:
-			return 0, fmt.Errorf("invalid log level: %s", *loglevelStr)
-		}
+		return ParseLevel(*loglevelStr)
 	}
 	level, err := levelFn()
 	if err != nil {
@@ -0,0 +1,182 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	promNamespace = "jaeger_postgresql"
+)
+
+// Tables are the tables that are vacuumed, reindexed and reported on.
+var Tables = []string{"spans", "services", "operations"}
+
+var (
+	promDeadTuplesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_dead_tuples",
+		Help:      "The estimated number of dead tuples in a table",
+	}, []string{"table"})
+
+	promBloatBytesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_bloat_bytes",
+		Help:      "The estimated number of bytes of a table occupied by dead tuples",
+	}, []string{"table"})
+
+	promLastAutovacuumGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_last_autovacuum_timestamp_seconds",
+		Help:      "The unix time of the last autovacuum of a table, or 0 if it was never autovacuumed",
+	}, []string{"table"})
+
+	promMaintenanceHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Name:      "maintenance_seconds",
+		Help:      "The time spent running a maintenance task",
+	}, []string{"task"})
+
+	promMaintenanceErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "maintenance_errors_total",
+		Help:      "The total number of failed maintenance tasks",
+	}, []string{"task"})
+)
+
+// Config configures the schedules of the maintenance loop. A zero interval
+// disables the corresponding task.
+type Config struct {
+	VacuumInterval  time.Duration
+	ReindexInterval time.Duration
+	StatsInterval   time.Duration
+}
+
+// Maintainer vacuums, reindexes and reports bloat for the plugin's tables.
+type Maintainer struct {
+	q      *sql.Queries
+	logger *slog.Logger
+}
+
+// New returns a new Maintainer.
+func New(q *sql.Queries, logger *slog.Logger) *Maintainer {
+	return &Maintainer{
+		q:      q,
+		logger: logger,
+	}
+}
+
+// Vacuum runs VACUUM (ANALYZE) on every maintained table.
+func (m *Maintainer) Vacuum(ctx context.Context) error {
+	return m.observe("vacuum", func() error {
+		for _, table := range Tables {
+			m.logger.Info("vacuuming table", "table", table)
+			if err := m.q.VacuumAnalyze(ctx, table); err != nil {
+				return fmt.Errorf("failed to vacuum %s: %w", table, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Reindex runs REINDEX CONCURRENTLY on every maintained table.
+func (m *Maintainer) Reindex(ctx context.Context) error {
+	return m.observe("reindex", func() error {
+		for _, table := range Tables {
+			m.logger.Info("reindexing table", "table", table)
+			if err := m.q.ReindexConcurrently(ctx, table); err != nil {
+				return fmt.Errorf("failed to reindex %s: %w", table, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// CollectStats updates the dead tuple, bloat and autovacuum gauges.
+func (m *Maintainer) CollectStats(ctx context.Context) error {
+	return m.observe("stats", func() error {
+		stats, err := m.q.GetTableMaintenanceStats(ctx, Tables)
+		if err != nil {
+			return fmt.Errorf("failed to query table stats: %w", err)
+		}
+
+		for _, stat := range stats {
+			promDeadTuplesGauge.WithLabelValues(stat.TableName).Set(float64(stat.DeadTuples))
+			promBloatBytesGauge.WithLabelValues(stat.TableName).Set(stat.BloatBytes())
+
+			var lastAutovacuum float64
+			if stat.LastAutovacuum.Valid {
+				lastAutovacuum = float64(stat.LastAutovacuum.Time.Unix())
+			}
+			promLastAutovacuumGauge.WithLabelValues(stat.TableName).Set(lastAutovacuum)
+		}
+
+		return nil
+	})
+}
+
+// Run executes the maintenance tasks on their configured schedules until the
+// context is cancelled.
+func (m *Maintainer) Run(ctx context.Context, cfg Config) {
+	vacuumC, stopVacuum := tick(cfg.VacuumInterval)
+	defer stopVacuum()
+
+	reindexC, stopReindex := tick(cfg.ReindexInterval)
+	defer stopReindex()
+
+	statsC, stopStats := tick(cfg.StatsInterval)
+	defer stopStats()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-vacuumC:
+			if err := m.Vacuum(ctx); err != nil {
+				m.logger.Error("failed to vacuum tables", "err", err)
+			}
+		case <-reindexC:
+			if err := m.Reindex(ctx); err != nil {
+				m.logger.Error("failed to reindex tables", "err", err)
+			}
+		case <-statsC:
+			if err := m.CollectStats(ctx); err != nil {
+				m.logger.Error("failed to collect table stats", "err", err)
+			}
+		}
+	}
+}
+
+func (m *Maintainer) observe(task string, fn func() error) error {
+	start := time.Now()
+	defer func() {
+		promMaintenanceHistogram.WithLabelValues(task).Observe(time.Since(start).Seconds())
+	}()
+
+	err := fn()
+	if err != nil {
+		promMaintenanceErrorsCounter.WithLabelValues(task).Inc()
+	}
+
+	return err
+}
+
+// tick returns a channel that fires every interval along with a function that
+// stops it. When the interval is not positive the channel is nil, so it never
+// fires.
+func tick(interval time.Duration) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
@@ -0,0 +1,257 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	promNamespace = "jaeger_postgresql"
+
+	// DefaultMask replaces masked values when no mask is configured.
+	DefaultMask = "[REDACTED]"
+)
+
+var (
+	promRedactionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "redactions_total",
+		Help:      "The total number of tags and log fields redacted",
+	}, []string{"rule", "action"})
+)
+
+// Action is what happens to a tag matched by a rule.
+type Action string
+
+const (
+	// ActionDrop removes the tag.
+	ActionDrop Action = "drop"
+
+	// ActionMask replaces the matched value with the mask.
+	ActionMask Action = "mask"
+
+	// ActionHash replaces the matched value with its keyed hash, so equal
+	// values can still be correlated without being readable.
+	ActionHash Action = "hash"
+)
+
+// Rule matches tags by key, by value, or both.
+type Rule struct {
+	// Name identifies the rule in metrics.
+	Name string
+
+	// Keys are the tag keys the rule applies to, compared case
+	// insensitively. An empty list matches every key.
+	Keys []string
+
+	// ValuePattern, if set, restricts the rule to string values matching it.
+	// Only the matching parts of the value are masked or hashed.
+	ValuePattern string
+
+	Action Action
+}
+
+// Config configures a Redactor.
+type Config struct {
+	// AllowKeys are never redacted, regardless of the rules.
+	AllowKeys []string
+
+	Rules []Rule
+
+	// Mask replaces masked values. Defaults to DefaultMask.
+	Mask string
+
+	// HashKey is the HMAC key used by the hash action.
+	HashKey []byte
+}
+
+type rule struct {
+	name    string
+	keys    map[string]struct{}
+	pattern *regexp.Regexp
+	action  Action
+}
+
+func (r rule) matchesKey(key string) bool {
+	if len(r.keys) == 0 {
+		return true
+	}
+
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+// Redactor removes or obscures sensitive tag values.
+type Redactor struct {
+	allow   map[string]struct{}
+	rules   []rule
+	mask    string
+	hashKey []byte
+}
+
+// New compiles the config into a Redactor.
+func New(cfg Config) (*Redactor, error) {
+	r := &Redactor{
+		allow:   lowerSet(cfg.AllowKeys),
+		mask:    cfg.Mask,
+		hashKey: cfg.HashKey,
+	}
+
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+
+	for i, cfgRule := range cfg.Rules {
+		name := cfgRule.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		compiled := rule{
+			name:   name,
+			keys:   lowerSet(cfgRule.Keys),
+			action: cfgRule.Action,
+		}
+
+		switch cfgRule.Action {
+		case ActionDrop, ActionMask:
+		case ActionHash:
+			if len(cfg.HashKey) == 0 {
+				return nil, fmt.Errorf("redaction rule %s uses the hash action but no hash key is configured", name)
+			}
+		default:
+			return nil, fmt.Errorf("redaction rule %s has invalid action: %q", name, cfgRule.Action)
+		}
+
+		if cfgRule.ValuePattern != "" {
+			pattern, err := regexp.Compile(cfgRule.ValuePattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %s has invalid value pattern: %w", name, err)
+			}
+
+			compiled.pattern = pattern
+		}
+
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+// RedactTags returns the tags with all rules applied. The input is never
+// modified.
+func (r *Redactor) RedactTags(tags []model.KeyValue) []model.KeyValue {
+	if len(r.rules) == 0 || len(tags) == 0 {
+		return tags
+	}
+
+	redacted := make([]model.KeyValue, 0, len(tags))
+	for _, tag := range tags {
+		if tag, keep := r.redact(tag); keep {
+			redacted = append(redacted, tag)
+		}
+	}
+
+	return redacted
+}
+
+// RedactLogs returns the logs with all rules applied to their fields. The
+// input is never modified.
+func (r *Redactor) RedactLogs(logs []model.Log) []model.Log {
+	if len(r.rules) == 0 || len(logs) == 0 {
+		return logs
+	}
+
+	redacted := make([]model.Log, len(logs))
+	for i, log := range logs {
+		redacted[i] = model.Log{
+			Timestamp: log.Timestamp,
+			Fields:    r.RedactTags(log.Fields),
+		}
+	}
+
+	return redacted
+}
+
+// redact applies the first matching rule to the tag, returning false if the
+// tag is dropped.
+func (r *Redactor) redact(tag model.KeyValue) (model.KeyValue, bool) {
+	if _, ok := r.allow[strings.ToLower(tag.Key)]; ok {
+		return tag, true
+	}
+
+	for _, rule := range r.rules {
+		if !rule.matchesKey(tag.Key) {
+			continue
+		}
+
+		if rule.pattern != nil {
+			if tag.VType != model.StringType || !rule.pattern.MatchString(tag.VStr) {
+				continue
+			}
+		}
+
+		promRedactionsCounter.WithLabelValues(rule.name, string(rule.action)).Inc()
+
+		if rule.action == ActionDrop {
+			return tag, false
+		}
+
+		replace := func(string) string { return r.mask }
+		if rule.action == ActionHash {
+			replace = r.hash
+		}
+
+		if rule.pattern != nil {
+			return model.String(tag.Key, rule.pattern.ReplaceAllStringFunc(tag.VStr, replace)), true
+		}
+
+		return model.String(tag.Key, replace(stringValue(tag))), true
+	}
+
+	return tag, true
+}
+
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// stringValue formats a tag value the same way regardless of its type, so
+// that hashes of equal values are equal.
+func stringValue(tag model.KeyValue) string {
+	switch tag.VType {
+	case model.StringType:
+		return tag.VStr
+	case model.BoolType:
+		return strconv.FormatBool(tag.VBool)
+	case model.Int64Type:
+		return strconv.FormatInt(tag.VInt64, 10)
+	case model.Float64Type:
+		return strconv.FormatFloat(tag.VFloat64, 'f', -1, 64)
+	case model.BinaryType:
+		return base64.RawStdEncoding.EncodeToString(tag.VBinary)
+	default:
+		return ""
+	}
+}
+
+func lowerSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = struct{}{}
+	}
+
+	return set
+}
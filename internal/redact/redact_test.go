@@ -0,0 +1,97 @@
+package redact
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Run("should reject unknown actions", func(t *testing.T) {
+		_, err := New(Config{Rules: []Rule{{Keys: []string{"token"}, Action: "shred"}}})
+		require.Error(t, err)
+	})
+
+	t.Run("should require a hash key for the hash action", func(t *testing.T) {
+		_, err := New(Config{Rules: []Rule{{Keys: []string{"token"}, Action: ActionHash}}})
+		require.Error(t, err)
+	})
+
+	t.Run("should drop and mask by key", func(t *testing.T) {
+		r, err := New(Config{Rules: []Rule{
+			{Keys: []string{"Authorization"}, Action: ActionDrop},
+			{Keys: []string{"user.id"}, Action: ActionMask},
+		}})
+		require.Nil(t, err)
+
+		tags := []model.KeyValue{
+			model.String("authorization", "Bearer secret"),
+			model.Int64("user.id", 42),
+			model.String("http.method", "GET"),
+		}
+
+		require.Equal(t, []model.KeyValue{
+			model.String("user.id", DefaultMask),
+			model.String("http.method", "GET"),
+		}, r.RedactTags(tags))
+
+		// the input must be left untouched
+		require.Equal(t, "Bearer secret", tags[0].VStr)
+	})
+
+	t.Run("should only replace the parts of a value matching the pattern", func(t *testing.T) {
+		r, err := New(Config{Rules: []Rule{
+			{ValuePattern: `[a-z]+@example\.com`, Action: ActionMask},
+		}})
+		require.Nil(t, err)
+
+		require.Equal(t, []model.KeyValue{
+			model.String("message", "sent to [REDACTED] and [REDACTED]"),
+			model.Int64("count", 2),
+		}, r.RedactTags([]model.KeyValue{
+			model.String("message", "sent to alice@example.com and bob@example.com"),
+			model.Int64("count", 2),
+		}))
+	})
+
+	t.Run("should hash values consistently", func(t *testing.T) {
+		r, err := New(Config{
+			HashKey: []byte("key"),
+			Rules:   []Rule{{Keys: []string{"email"}, Action: ActionHash}},
+		})
+		require.Nil(t, err)
+
+		first := r.RedactTags([]model.KeyValue{model.String("email", "alice@example.com")})
+		second := r.RedactTags([]model.KeyValue{model.String("email", "alice@example.com")})
+
+		require.Equal(t, first, second)
+		require.NotEqual(t, "alice@example.com", first[0].VStr)
+		require.Len(t, first[0].VStr, 64)
+	})
+
+	t.Run("should never redact allowed keys", func(t *testing.T) {
+		r, err := New(Config{
+			AllowKeys: []string{"span.kind"},
+			Rules:     []Rule{{Action: ActionDrop}},
+		})
+		require.Nil(t, err)
+
+		require.Equal(t, []model.KeyValue{model.String("span.kind", "server")}, r.RedactTags([]model.KeyValue{
+			model.String("span.kind", "server"),
+			model.String("anything", "else"),
+		}))
+	})
+
+	t.Run("should redact log fields", func(t *testing.T) {
+		r, err := New(Config{Rules: []Rule{{Keys: []string{"password"}, Action: ActionDrop}}})
+		require.Nil(t, err)
+
+		ts := time.Now()
+		require.Equal(t, []model.Log{{Timestamp: ts, Fields: []model.KeyValue{model.String("event", "login")}}}, r.RedactLogs([]model.Log{{
+			Timestamp: ts,
+			Fields:    []model.KeyValue{model.String("event", "login"), model.String("password", "hunter2")},
+		}}))
+	})
+}
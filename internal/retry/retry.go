@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultInitialInterval is the wait before the first retry.
+	DefaultInitialInterval = time.Second
+
+	// DefaultMaxInterval caps the wait between two attempts.
+	DefaultMaxInterval = time.Second * 30
+)
+
+// Config configures the backoff between attempts.
+type Config struct {
+	// InitialInterval is the wait before the first retry. It doubles after
+	// every failed attempt, up to MaxInterval.
+	InitialInterval time.Duration `mapstructure:"initial-interval"`
+	MaxInterval     time.Duration `mapstructure:"max-interval"`
+
+	// MaxElapsedTime is how long to keep retrying before giving up. Zero
+	// retries until the context is done.
+	MaxElapsedTime time.Duration `mapstructure:"max-elapsed-time"`
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying cannot fix, so that Do returns it
+// right away.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds or fails with a Permanent error, waiting with
+// exponential backoff between attempts. Failed attempts are logged with op,
+// which describes what is being attempted. The error of the last attempt is
+// returned when giving up.
+func Do(ctx context.Context, cfg Config, logger *slog.Logger, op string, fn func(ctx context.Context) error) error {
+	interval := cfg.InitialInterval
+	if interval <= 0 {
+		interval = DefaultInitialInterval
+	}
+
+	maxInterval := cfg.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultMaxInterval
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("succeeded after retrying", "op", op, "attempts", attempt)
+			}
+
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+
+		// wait between half and the whole interval, so that replicas started
+		// together do not retry in lockstep
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+
+		if cfg.MaxElapsedTime > 0 && time.Since(start)+wait > cfg.MaxElapsedTime {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+
+		logger.Warn("failed, retrying", "op", op, "attempt", attempt, "wait", wait, "err", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		case <-timer.C:
+		}
+
+		interval = min(interval*2, maxInterval)
+	}
+}
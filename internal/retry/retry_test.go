@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	cfg := Config{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond * 4,
+	}
+
+	t.Run("should retry until the operation succeeds", func(t *testing.T) {
+		attempts := 0
+		err := Do(context.Background(), cfg, slog.Default(), "test", func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("unavailable")
+			}
+
+			return nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("should give up after the max elapsed time", func(t *testing.T) {
+		cfg := cfg
+		cfg.MaxElapsedTime = time.Millisecond * 20
+
+		unavailable := errors.New("unavailable")
+		err := Do(context.Background(), cfg, slog.Default(), "test", func(ctx context.Context) error {
+			return unavailable
+		})
+		require.ErrorIs(t, err, unavailable)
+	})
+
+	t.Run("should not retry permanent errors", func(t *testing.T) {
+		invalid := errors.New("invalid")
+		attempts := 0
+		err := Do(context.Background(), cfg, slog.Default(), "test", func(ctx context.Context) error {
+			attempts++
+			return Permanent(invalid)
+		})
+		require.Equal(t, invalid, err)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("should give up when the context is done", func(t *testing.T) {
+		ctx, cancelFn := context.WithCancel(context.Background())
+
+		unavailable := errors.New("unavailable")
+		attempts := 0
+		err := Do(ctx, cfg, slog.Default(), "test", func(ctx context.Context) error {
+			attempts++
+			cancelFn()
+			return unavailable
+		})
+		require.ErrorIs(t, err, unavailable)
+		require.Equal(t, 1, attempts)
+	})
+}
@@ -0,0 +1,198 @@
+package selftrace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The exporters that self traces can be sent with.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// DefaultServiceName is the service name of self traces when none is
+// configured.
+const DefaultServiceName = "jaeger-postgresql"
+
+// instrumentationName names the tracer that self traces are made with.
+const instrumentationName = "github.com/Guy-Adler/jaeger-postgresql"
+
+// Config configures self tracing.
+type Config struct {
+	// Exporter is one of ExporterNone, ExporterOTLP and ExporterStdout.
+	Exporter string `mapstructure:"exporter"`
+
+	// Endpoint is the host:port of the OTLP gRPC receiver, e.g. an
+	// OpenTelemetry collector.
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"`
+
+	// ServiceName is the service name of the self traces. Spans written under
+	// it are not traced themselves, so that self traces exported to a
+	// collector that stores into this plugin do not loop.
+	ServiceName string `mapstructure:"service-name"`
+
+	// SampleRatio is the share of traces that are sampled, from 0 to 1.
+	SampleRatio float64 `mapstructure:"sample-ratio"`
+}
+
+// Enabled reports whether self tracing is configured.
+func (c Config) Enabled() bool {
+	return c.Exporter != "" && c.Exporter != ExporterNone
+}
+
+// SelfServiceName returns the service name of the self traces.
+func (c Config) SelfServiceName() string {
+	if c.ServiceName == "" {
+		return DefaultServiceName
+	}
+
+	return c.ServiceName
+}
+
+// NewTracerProvider returns a tracer provider that exports with the configured
+// exporter. The stdout exporter writes to w, or to stdout if w is nil.
+func NewTracerProvider(ctx context.Context, cfg Config, w io.Writer) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		var err error
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+	case ExporterStdout:
+		if w == nil {
+			w = os.Stdout
+		}
+
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter: %q", cfg.Exporter)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.SelfServiceName()))),
+		sdktrace.WithSampler(suppressingSampler{sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))}),
+	), nil
+}
+
+// Tracer returns the tracer that self traces are made with.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(instrumentationName)
+}
+
+type suppressKey struct{}
+
+// Suppress returns a context that nothing is traced within.
+func Suppress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressKey{}, true)
+}
+
+// Suppressed reports whether tracing is suppressed within the context.
+func Suppressed(ctx context.Context) bool {
+	suppressed, _ := ctx.Value(suppressKey{}).(bool)
+	return suppressed
+}
+
+// suppressingSampler drops the spans started in suppressed contexts.
+type suppressingSampler struct {
+	sdktrace.Sampler
+}
+
+func (s suppressingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if Suppressed(p.ParentContext) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+
+	return s.Sampler.ShouldSample(p)
+}
+
+var _ pgx.QueryTracer = (*QueryTracer)(nil)
+
+// QueryTracer is a pgx.QueryTracer that makes a span of every query. The
+// query parameters are not recorded, as they may hold span data.
+type QueryTracer struct {
+	tracer trace.Tracer
+}
+
+// NewQueryTracer returns a QueryTracer that makes spans with the provider.
+func NewQueryTracer(provider trace.TracerProvider) *QueryTracer {
+	return &QueryTracer{tracer: Tracer(provider)}
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, QueryName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(data.SQL),
+			semconv.DBName(conn.Config().Database),
+		),
+	)
+
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+}
+
+// QueryName returns the name of a query from its "-- name: Name :kind"
+// comment, or "query" for queries without one.
+func QueryName(sql string) string {
+	const prefix = "-- name: "
+
+	sql = strings.TrimSpace(sql)
+	if !strings.HasPrefix(sql, prefix) {
+		return "query"
+	}
+
+	fields := strings.Fields(sql[len(prefix):])
+	if len(fields) == 0 {
+		return "query"
+	}
+
+	return fields[0]
+}
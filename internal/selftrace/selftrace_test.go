@@ -0,0 +1,42 @@
+package selftrace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTrace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should name queries after their name comment", func(t *testing.T) {
+		require.Equal(t, "GetTraceSpans", QueryName("-- name: GetTraceSpans :many\nSELECT 1"))
+		require.Equal(t, "query", QueryName("SELECT 1"))
+	})
+
+	t.Run("should reject an unknown exporter", func(t *testing.T) {
+		_, err := NewTracerProvider(ctx, Config{Exporter: "zipkin"}, nil)
+		require.NotNil(t, err)
+	})
+
+	t.Run("should not export spans started in suppressed contexts", func(t *testing.T) {
+		var out bytes.Buffer
+		provider, err := NewTracerProvider(ctx, Config{Exporter: ExporterStdout, SampleRatio: 1}, &out)
+		require.Nil(t, err)
+
+		_, span := Tracer(provider).Start(Suppress(ctx), "suppressed")
+		require.False(t, span.IsRecording())
+		span.End()
+
+		_, span = Tracer(provider).Start(ctx, "traced")
+		require.True(t, span.IsRecording())
+		span.End()
+
+		require.Nil(t, provider.Shutdown(ctx))
+		require.Contains(t, out.String(), `"Name":"traced"`)
+		require.NotContains(t, out.String(), `"Name":"suppressed"`)
+		require.Contains(t, out.String(), DefaultServiceName)
+	})
+}
@@ -0,0 +1,292 @@
+package slowquery
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/selftrace"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const promNamespace = "jaeger_postgresql"
+
+// Where the EXPLAIN output of slow FindTraceIDs queries goes.
+const (
+	ExplainNone     = "none"
+	ExplainLog      = "log"
+	ExplainEndpoint = "endpoint"
+)
+
+// DefaultKeep is the number of slow queries kept for the endpoint when none is
+// configured.
+const DefaultKeep = 20
+
+// explainedQuery is the query whose plans are captured. Its plan depends on
+// which of its filters are enabled, which is what makes it slow.
+const explainedQuery = "FindTraceIDs"
+
+// tagMask replaces tag values in the logged parameters.
+const tagMask = "xxxxx"
+
+var promSlowQueriesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: promNamespace,
+	Name:      "slow_queries_total",
+	Help:      "The total number of queries slower than the slow query threshold, by query",
+}, []string{"query"})
+
+// Config configures the slow query log.
+type Config struct {
+	// Threshold is the duration above which queries are logged. Zero disables
+	// the log.
+	Threshold time.Duration `mapstructure:"threshold"`
+
+	// MaskTags masks the values of the tags searched for, which may be
+	// sensitive.
+	MaskTags bool `mapstructure:"mask-tags"`
+
+	// Explain is one of ExplainNone, ExplainLog and ExplainEndpoint.
+	Explain        string        `mapstructure:"explain"`
+	ExplainTimeout time.Duration `mapstructure:"explain-timeout"`
+
+	// Keep is the number of slow queries kept for the endpoint, with their
+	// plans when Explain is ExplainEndpoint.
+	Keep int `mapstructure:"keep"`
+}
+
+// Enabled reports whether the slow query log is configured.
+func (c Config) Enabled() bool {
+	return c.Threshold > 0
+}
+
+// Entry is a slow query.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Query    string    `json:"query"`
+	Duration string    `json:"duration"`
+	Params   []any     `json:"params"`
+	Error    string    `json:"error,omitempty"`
+	Plan     string    `json:"plan,omitempty"`
+}
+
+type startKey struct{}
+
+type start struct {
+	time time.Time
+	sql  string
+	args []any
+}
+
+type skipKey struct{}
+
+// Log is a pgx.QueryTracer that logs the queries slower than the threshold.
+type Log struct {
+	cfg    Config
+	logger *slog.Logger
+
+	explainDB  atomic.Pointer[sql.DBTX]
+	explaining atomic.Bool
+
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+var _ pgx.QueryTracer = (*Log)(nil)
+
+// New returns a Log.
+func New(cfg Config, logger *slog.Logger) *Log {
+	if cfg.Keep <= 0 {
+		cfg.Keep = DefaultKeep
+	}
+
+	return &Log{cfg: cfg, logger: logger}
+}
+
+// SetExplainDB sets the database that slow queries are explained on. Plans are
+// only captured once it is set.
+func (l *Log) SetExplainDB(db sql.DBTX) {
+	l.explainDB.Store(&db)
+}
+
+// Entries returns the latest slow queries, newest first.
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]Entry, len(l.entries))
+	for i, entry := range l.entries {
+		entries[len(entries)-1-i] = *entry
+	}
+
+	return entries
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (l *Log) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, startKey{}, start{time: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (l *Log) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	s, ok := ctx.Value(startKey{}).(start)
+	if !ok || ctx.Value(skipKey{}) != nil {
+		return
+	}
+
+	duration := time.Since(s.time)
+	if duration < l.cfg.Threshold {
+		return
+	}
+
+	name := selftrace.QueryName(s.sql)
+	promSlowQueriesCounter.WithLabelValues(name).Inc()
+
+	entry := &Entry{
+		Time:     s.time,
+		Query:    name,
+		Duration: duration.String(),
+		Params:   l.params(s.args),
+	}
+	if data.Err != nil {
+		entry.Error = data.Err.Error()
+	}
+
+	l.logger.Warn("slow query", "query", name, "duration", duration, "params", entry.Params, "err", data.Err)
+
+	l.keep(entry)
+
+	if name == explainedQuery && (l.cfg.Explain == ExplainLog || l.cfg.Explain == ExplainEndpoint) {
+		l.explain(tenancy.GetTenant(ctx), entry, s)
+	}
+}
+
+// keep adds the entry to the entries, dropping the oldest beyond Keep.
+func (l *Log) keep(entry *Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.cfg.Keep {
+		l.entries = l.entries[len(l.entries)-l.cfg.Keep:]
+	}
+}
+
+// explain captures the plan of the query in the background. EXPLAIN ANALYZE
+// runs the query again, so only one query is explained at a time and the
+// others are skipped. It runs as the tenant of the query, as row level
+// security would otherwise hide every row and make the plan meaningless.
+func (l *Log) explain(tenant string, entry *Entry, s start) {
+	db := l.explainDB.Load()
+	if db == nil || !l.explaining.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer l.explaining.Store(false)
+
+		timeout := l.cfg.ExplainTimeout
+		if timeout <= 0 {
+			timeout = time.Second * 30
+		}
+
+		// the request may be over before the plan is, so only its tenant is
+		// kept
+		ctx, cancelFn := context.WithTimeout(tenancy.WithTenant(context.Background(), tenant), timeout)
+		defer cancelFn()
+
+		// the explain is at least as slow as the query, and is not logged
+		// itself
+		ctx = context.WithValue(ctx, skipKey{}, true)
+
+		plan, err := queryPlan(ctx, *db, s)
+		if err != nil {
+			l.logger.Error("failed to explain slow query", "query", entry.Query, "err", err)
+			return
+		}
+
+		if l.cfg.Explain == ExplainLog {
+			l.logger.Warn("slow query plan", "query", entry.Query, "params", entry.Params, "plan", plan)
+			return
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		entry.Plan = plan
+	}()
+}
+
+// queryPlan returns the output of EXPLAIN (ANALYZE, BUFFERS) of the query.
+func queryPlan(ctx context.Context, db sql.DBTX, s start) (string, error) {
+	// the query starts with its name comment, which ends at the line break
+	rows, err := db.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+s.sql, s.args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// params formats the query parameters for humans, masking the tag values if
+// configured.
+func (l *Log) params(args []any) []any {
+	params := make([]any, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case []sql.TagContent:
+			tags := make(map[string]string, len(arg))
+			for _, tag := range arg {
+				tags[tag.Key] = tag.Value
+				if l.cfg.MaskTags {
+					tags[tag.Key] = tagMask
+				}
+			}
+			params[i] = tags
+		case pgtype.Timestamp:
+			params[i] = arg.Time
+		case pgtype.Interval:
+			params[i] = (time.Duration(arg.Microseconds) * time.Microsecond).String()
+		case []byte:
+			// tags and logs are bound as json, the ids as raw bytes
+			switch {
+			case !json.Valid(arg):
+				params[i] = hex.EncodeToString(arg)
+			case l.cfg.MaskTags:
+				params[i] = fmt.Sprintf("<%d bytes of json>", len(arg))
+			default:
+				params[i] = string(arg)
+			}
+		case fmt.Stringer:
+			params[i] = arg.String()
+		default:
+			params[i] = arg
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,137 @@
+package slowquery
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/stretchr/testify/require"
+)
+
+// explainDB is a sql.DBTX that answers EXPLAIN with a fixed plan, recording
+// the query and the tenant it was run as.
+type explainDB struct {
+	mu     sync.Mutex
+	sql    string
+	tenant string
+}
+
+func (db *explainDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *explainDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.sql = sql
+	db.tenant = tenancy.GetTenant(ctx)
+	return &planRows{lines: []string{"Limit", "  ->  Index Scan using spans_start_time_idx on spans"}, i: -1}, nil
+}
+
+func (db *explainDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return nil
+}
+
+func (db *explainDB) queried() (string, string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.sql, db.tenant
+}
+
+// planRows are the rows of an EXPLAIN, one line of the plan each.
+type planRows struct {
+	lines []string
+	i     int
+}
+
+func (r *planRows) Close()                                       {}
+func (r *planRows) Err() error                                   { return nil }
+func (r *planRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *planRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *planRows) Values() ([]any, error)                       { return []any{r.lines[r.i]}, nil }
+func (r *planRows) RawValues() [][]byte                          { return [][]byte{[]byte(r.lines[r.i])} }
+func (r *planRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *planRows) Next() bool {
+	r.i++
+	return r.i < len(r.lines)
+}
+
+func (r *planRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.lines[r.i]
+	return nil
+}
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+
+	// query runs a query through the log that takes the duration
+	query := func(l *Log, duration time.Duration, args ...any) {
+		ctx := l.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "-- name: FindTraceIDs :many\nSELECT 1", Args: args})
+		time.Sleep(duration)
+		l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	}
+
+	t.Run("should only log queries slower than the threshold", func(t *testing.T) {
+		l := New(Config{Threshold: time.Millisecond * 10}, slog.Default())
+
+		query(l, 0)
+		require.Empty(t, l.Entries())
+
+		query(l, time.Millisecond*20)
+		require.Len(t, l.Entries(), 1)
+		require.Equal(t, "FindTraceIDs", l.Entries()[0].Query)
+	})
+
+	t.Run("should mask tag values", func(t *testing.T) {
+		l := New(Config{Threshold: time.Nanosecond, MaskTags: true}, slog.Default())
+
+		query(l, 0, "service", []sql.TagContent{{Key: "user.email", Value: "jane@example.com"}})
+		require.Equal(t, []any{"service", map[string]string{"user.email": tagMask}}, l.Entries()[0].Params)
+	})
+
+	t.Run("should keep the latest queries, newest first", func(t *testing.T) {
+		l := New(Config{Threshold: time.Nanosecond, Keep: 2}, slog.Default())
+
+		for _, service := range []string{"first", "second", "third"} {
+			query(l, 0, service)
+		}
+
+		entries := l.Entries()
+		require.Len(t, entries, 2)
+		require.Equal(t, []any{"third"}, entries[0].Params)
+		require.Equal(t, []any{"second"}, entries[1].Params)
+	})
+
+	t.Run("should capture the plan as the tenant of the query", func(t *testing.T) {
+		l := New(Config{Threshold: time.Nanosecond, Explain: ExplainEndpoint}, slog.Default())
+
+		db := &explainDB{}
+		l.SetExplainDB(db)
+
+		// the request is over by the time the plan is captured
+		ctx, cancelFn := context.WithCancel(tenancy.WithTenant(ctx, "acme"))
+		ctx = l.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "-- name: FindTraceIDs :many\nSELECT 1", Args: []any{"service"}})
+		l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+		cancelFn()
+
+		require.Eventually(t, func() bool {
+			return l.Entries()[0].Plan != ""
+		}, time.Second, time.Millisecond*10)
+
+		require.Equal(t, "Limit\n  ->  Index Scan using spans_start_time_idx on spans", l.Entries()[0].Plan)
+
+		sql, tenant := db.queried()
+		require.True(t, strings.HasPrefix(sql, "EXPLAIN (ANALYZE, BUFFERS) -- name: FindTraceIDs"))
+		require.Equal(t, "acme", tenant)
+	})
+}
@@ -0,0 +1,47 @@
+package sql
+
+import (
+	"context"
+)
+
+const tryAdvisoryLock = `-- name: TryAdvisoryLock :one
+SELECT pg_try_advisory_lock($1::BIGINT)
+`
+
+// TryAdvisoryLock attempts to take a session level advisory lock without
+// waiting. The lock is held until it is released with AdvisoryUnlock or the
+// connection is closed, so it must be called on a dedicated connection rather
+// than a pool.
+func (q *Queries) TryAdvisoryLock(ctx context.Context, key int64) (bool, error) {
+	row := q.db.QueryRow(ctx, tryAdvisoryLock, key)
+	var pg_try_advisory_lock bool
+	err := row.Scan(&pg_try_advisory_lock)
+	return pg_try_advisory_lock, err
+}
+
+const advisoryUnlock = `-- name: AdvisoryUnlock :one
+SELECT pg_advisory_unlock($1::BIGINT)
+`
+
+// AdvisoryUnlock releases a session level advisory lock taken with
+// TryAdvisoryLock. It returns false if the lock was not held.
+func (q *Queries) AdvisoryUnlock(ctx context.Context, key int64) (bool, error) {
+	row := q.db.QueryRow(ctx, advisoryUnlock, key)
+	var pg_advisory_unlock bool
+	err := row.Scan(&pg_advisory_unlock)
+	return pg_advisory_unlock, err
+}
+
+const schemaLockKey = `-- name: SchemaLockKey :one
+SELECT hashtextextended($1::TEXT || '.' || current_schema(), 0)
+`
+
+// SchemaLockKey derives an advisory lock key from the name and the current
+// schema. Advisory locks are database wide, so deployments sharing a database
+// through different schemas must not use the same keys.
+func (q *Queries) SchemaLockKey(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRow(ctx, schemaLockKey, name)
+	var hashtextextended int64
+	err := row.Scan(&hashtextextended)
+	return hashtextextended, err
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// VacuumAnalyze runs VACUUM (ANALYZE) against the given table. VACUUM cannot
+// run inside a transaction block, so this must not be called on a Queries
+// returned from WithTx.
+func (q *Queries) VacuumAnalyze(ctx context.Context, table string) error {
+	_, err := q.db.Exec(ctx, fmt.Sprintf("VACUUM (ANALYZE) %s", pgx.Identifier{table}.Sanitize()))
+	return err
+}
+
+// ReindexConcurrently rebuilds all indexes of the given table without taking
+// locks that block writes. Like VACUUM, it cannot run inside a transaction.
+func (q *Queries) ReindexConcurrently(ctx context.Context, table string) error {
+	_, err := q.db.Exec(ctx, fmt.Sprintf("REINDEX TABLE CONCURRENTLY %s", pgx.Identifier{table}.Sanitize()))
+	return err
+}
+
+const getTableMaintenanceStats = `-- name: GetTableMaintenanceStats :many
+SELECT
+  pg_stat_user_tables.relname::TEXT AS table_name,
+  pg_stat_user_tables.n_live_tup AS live_tuples,
+  pg_stat_user_tables.n_dead_tup AS dead_tuples,
+  pg_table_size(pg_stat_user_tables.relid) AS table_bytes,
+  pg_stat_user_tables.last_vacuum AS last_vacuum,
+  pg_stat_user_tables.last_autovacuum AS last_autovacuum,
+  pg_stat_user_tables.last_analyze AS last_analyze,
+  pg_stat_user_tables.last_autoanalyze AS last_autoanalyze
+FROM pg_stat_user_tables
+WHERE pg_stat_user_tables.relname = ANY($1::TEXT[])
+  AND pg_stat_user_tables.schemaname = current_schema()
+`
+
+type GetTableMaintenanceStatsRow struct {
+	TableName       string
+	LiveTuples      int64
+	DeadTuples      int64
+	TableBytes      int64
+	LastVacuum      pgtype.Timestamptz
+	LastAutovacuum  pgtype.Timestamptz
+	LastAnalyze     pgtype.Timestamptz
+	LastAutoanalyze pgtype.Timestamptz
+}
+
+// BloatBytes estimates the number of bytes of the table occupied by dead
+// tuples, assuming dead and live tuples have the same average width.
+func (r GetTableMaintenanceStatsRow) BloatBytes() float64 {
+	total := r.LiveTuples + r.DeadTuples
+	if total == 0 {
+		return 0
+	}
+
+	return float64(r.TableBytes) * float64(r.DeadTuples) / float64(total)
+}
+
+func (q *Queries) GetTableMaintenanceStats(ctx context.Context, tables []string) ([]GetTableMaintenanceStatsRow, error) {
+	rows, err := q.db.Query(ctx, getTableMaintenanceStats, tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTableMaintenanceStatsRow
+	for rows.Next() {
+		var i GetTableMaintenanceStatsRow
+		if err := rows.Scan(
+			&i.TableName,
+			&i.LiveTuples,
+			&i.DeadTuples,
+			&i.TableBytes,
+			&i.LastVacuum,
+			&i.LastAutovacuum,
+			&i.LastAnalyze,
+			&i.LastAutoanalyze,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
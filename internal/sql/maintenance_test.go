@@ -0,0 +1,52 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sqltest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloatBytes(t *testing.T) {
+	t.Run("should be zero for an empty table", func(t *testing.T) {
+		row := sql.GetTableMaintenanceStatsRow{TableBytes: 8192}
+		require.Equal(t, float64(0), row.BloatBytes())
+	})
+
+	t.Run("should be proportional to the dead tuples", func(t *testing.T) {
+		row := sql.GetTableMaintenanceStatsRow{TableBytes: 1000, LiveTuples: 75, DeadTuples: 25}
+		require.Equal(t, float64(250), row.BloatBytes())
+	})
+}
+
+func TestMaintenance(t *testing.T) {
+	ctx := context.Background()
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	q := sql.New(conn)
+
+	t.Run("should vacuum and reindex a table", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		require.Nil(t, q.VacuumAnalyze(ctx, "spans"))
+		require.Nil(t, q.ReindexConcurrently(ctx, "spans"))
+	})
+
+	t.Run("should return stats for the requested tables", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		stats, err := q.GetTableMaintenanceStats(ctx, []string{"spans", "services"})
+		require.Nil(t, err)
+
+		var tables []string
+		for _, stat := range stats {
+			tables = append(tables, stat.TableName)
+		}
+
+		require.ElementsMatch(t, []string{"spans", "services"}, tables)
+	})
+}
@@ -1,15 +1,20 @@
 package sql
 
 import (
+	"context"
+	stdsql "database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 var (
@@ -46,7 +51,159 @@ func (l *gooseLogger) Printf(msg string, v ...interface{}) {
 	l.Logger.Info(fmt.Sprintf(trimmed, v...))
 }
 
-func Migrate(logger *slog.Logger, connStr string) error {
+// migrationLockName names the advisory lock that serializes migrations across
+// processes sharing a database.
+const migrationLockName = "migrations"
+
+// migrationLockPollInterval is how often the migration lock is retried while
+// another process holds it.
+const migrationLockPollInterval = time.Second
+
+type migrateOptions struct {
+	schema      string
+	execMode    pgx.QueryExecMode
+	lockTimeout time.Duration
+}
+
+// MigrateOption configures Migrate.
+type MigrateOption func(*migrateOptions)
+
+// WithSchema applies the migrations to the given schema, creating it if
+// needed. The goose version table is kept in the same schema, so several
+// deployments can share one database by using different schemas.
+func WithSchema(schema string) MigrateOption {
+	return func(o *migrateOptions) {
+		o.schema = schema
+	}
+}
+
+// WithQueryExecMode sets the query exec mode of the migration connection, e.g.
+// to avoid named prepared statements when migrating through PgBouncer.
+func WithQueryExecMode(mode pgx.QueryExecMode) MigrateOption {
+	return func(o *migrateOptions) {
+		o.execMode = mode
+	}
+}
+
+// WithLockTimeout limits how long to wait for another process to finish
+// migrating. Zero waits indefinitely.
+func WithLockTimeout(timeout time.Duration) MigrateOption {
+	return func(o *migrateOptions) {
+		o.lockTimeout = timeout
+	}
+}
+
+// SetSearchPath sets the search_path run-time parameter of connections made
+// with the config to the schema. An empty schema leaves the server default.
+func SetSearchPath(config *pgx.ConnConfig, schema string) {
+	if schema == "" {
+		return
+	}
+
+	config.RuntimeParams["search_path"] = pgx.Identifier{schema}.Sanitize()
+}
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know, i.e. it was migrated by a newer version.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of jaeger-postgresql")
+
+// Migrate applies all pending migrations. Processes sharing a database, such
+// as several replicas and the cleaner, take turns through an advisory lock.
+func Migrate(logger *slog.Logger, connStr string, opts ...MigrateOption) error {
+	return migrationSession(logger, connStr, opts, false, func(db *stdsql.DB) error {
+		if err := checkVersion(db); err != nil {
+			return err
+		}
+
+		if err := goose.Up(db, "migrations"); err != nil {
+			return fmt.Errorf("unable to migrate database: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MigrateUpTo applies the pending migrations up to and including version.
+func MigrateUpTo(logger *slog.Logger, connStr string, version int64, opts ...MigrateOption) error {
+	return migrationSession(logger, connStr, opts, false, func(db *stdsql.DB) error {
+		if err := checkVersion(db); err != nil {
+			return err
+		}
+
+		if err := goose.UpTo(db, "migrations", version); err != nil {
+			return fmt.Errorf("unable to migrate database: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the latest migration.
+func MigrateDown(logger *slog.Logger, connStr string, opts ...MigrateOption) error {
+	return migrationSession(logger, connStr, opts, false, func(db *stdsql.DB) error {
+		if err := goose.Down(db, "migrations"); err != nil {
+			return fmt.Errorf("unable to roll back database: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MigrateDownTo rolls back the migrations newer than version.
+func MigrateDownTo(logger *slog.Logger, connStr string, version int64, opts ...MigrateOption) error {
+	return migrationSession(logger, connStr, opts, false, func(db *stdsql.DB) error {
+		if err := goose.DownTo(db, "migrations", version); err != nil {
+			return fmt.Errorf("unable to roll back database: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MigrationStatus logs whether each migration is applied.
+func MigrationStatus(logger *slog.Logger, connStr string, opts ...MigrateOption) error {
+	return migrationSession(logger, connStr, opts, true, func(db *stdsql.DB) error {
+		exists, err := versionTableExists(db)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			logger.Info("database has not been migrated")
+			return nil
+		}
+
+		if err := goose.Status(db, "migrations"); err != nil {
+			return fmt.Errorf("unable to get migration status: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MigrationVersions returns the schema version of the database and the
+// latest version known to this binary. It does not modify the database.
+func MigrationVersions(logger *slog.Logger, connStr string, opts ...MigrateOption) (current int64, latest int64, err error) {
+	err = migrationSession(logger, connStr, opts, true, func(db *stdsql.DB) error {
+		var err error
+		current, latest, err = versions(db)
+		return err
+	})
+
+	return current, latest, err
+}
+
+// migrationSession configures goose and runs fn with a connection to the
+// database. Unless readOnly, the schema is created and the migration lock is
+// held while fn runs.
+func migrationSession(logger *slog.Logger, connStr string, opts []MigrateOption, readOnly bool, fn func(db *stdsql.DB) error) error {
+	var options migrateOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// goose is configured through globals, so migrations within the process
+	// are serialized too
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -56,19 +213,189 @@ func Migrate(logger *slog.Logger, connStr string) error {
 
 	goose.SetDialect("pgx")
 
-	db, err := goose.OpenDBWithDriver("pgx", connStr)
+	connConfig, err := pgx.ParseConfig(connStr)
 	if err != nil {
-		return fmt.Errorf("connecting to db for migrations: %w", err)
+		return fmt.Errorf("parsing connection string for migrations: %w", err)
+	}
+	SetSearchPath(connConfig, options.schema)
+	if options.execMode != 0 {
+		connConfig.DefaultQueryExecMode = options.execMode
 	}
+
+	db := stdlib.OpenDB(*connConfig)
 	defer db.Close()
 
 	if err := goose.SetDialect("postgres"); err != nil {
 		return fmt.Errorf("setting postgres dialect for migrations: %w", err)
 	}
 
-	if err := goose.Up(db, "migrations"); err != nil {
-		return fmt.Errorf("unable to migrate database: %w", err)
+	goose.SetTableName("goose_db_version")
+	if options.schema != "" {
+		goose.SetTableName(pgx.Identifier{options.schema, "goose_db_version"}.Sanitize())
+	}
+
+	if readOnly {
+		return fn(db)
+	}
+
+	if options.schema != "" {
+		if _, err := db.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pgx.Identifier{options.schema}.Sanitize())); err != nil {
+			return fmt.Errorf("creating schema for migrations: %w", err)
+		}
+	}
+
+	unlock, err := lockMigrations(logger, connConfig, options.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn(db)
+}
+
+// versionTableExists reports whether the goose version table exists, without
+// creating it like goose does.
+func versionTableExists(db *stdsql.DB) (bool, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", goose.TableName()).Scan(&exists); err != nil {
+		return false, fmt.Errorf("checking for migration version table: %w", err)
+	}
+
+	return exists, nil
+}
+
+// versions returns the schema version of the database and the latest version
+// of the embedded migrations.
+func versions(db *stdsql.DB) (int64, int64, error) {
+	latest, err := LatestMigration()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	exists, err := versionTableExists(db)
+	if err != nil || !exists {
+		return 0, latest, err
+	}
+
+	current, err := goose.GetDBVersion(db)
+	if err != nil {
+		return 0, latest, fmt.Errorf("getting database version: %w", err)
+	}
+
+	return current, latest, nil
+}
+
+// LatestMigration returns the version of the latest migration embedded in
+// this binary.
+func LatestMigration() (int64, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("collecting migrations: %w", err)
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		version, err := goose.NumericComponent(entry.Name())
+		if err != nil {
+			return 0, fmt.Errorf("collecting migrations: %w", err)
+		}
+
+		latest = max(latest, version)
+	}
+
+	return latest, nil
+}
+
+const getSchemaVersion = `-- name: GetSchemaVersion :one
+SELECT COALESCE(max(version_id), 0)::BIGINT
+FROM (
+  SELECT DISTINCT ON (version_id) version_id, is_applied
+  FROM goose_db_version
+  ORDER BY version_id, id DESC
+) AS latest
+WHERE is_applied
+`
+
+// GetSchemaVersion returns the version the database is migrated to, like
+// goose does: the highest version whose latest migration row is applied. The
+// version table is looked up through the search_path, so the connection must
+// be configured with SetSearchPath.
+func (q *Queries) GetSchemaVersion(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, getSchemaVersion)
+	var version int64
+	err := row.Scan(&version)
+	return version, err
+}
+
+// checkVersion returns ErrSchemaTooNew if the database has migrations applied
+// beyond the embedded ones, which this binary cannot work with nor roll back.
+func checkVersion(db *stdsql.DB) error {
+	current, latest, err := versions(db)
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, but the latest known migration is %d", ErrSchemaTooNew, current, latest)
 	}
 
 	return nil
 }
+
+// lockMigrations takes the migration advisory lock on a dedicated connection,
+// waiting up to timeout for other processes to release it. The returned func
+// releases the lock by closing the connection.
+func lockMigrations(logger *slog.Logger, connConfig *pgx.ConnConfig, timeout time.Duration) (func(), error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, timeout)
+		defer cancelFn()
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to db for migration lock: %w", err)
+	}
+
+	unlock := func() {
+		ctx, cancelFn := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancelFn()
+
+		if err := conn.Close(ctx); err != nil {
+			logger.Warn("failed to close migration lock connection", "err", err)
+		}
+	}
+
+	q := New(conn)
+	key, err := q.SchemaLockKey(ctx, migrationLockName)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("deriving migration lock key: %w", err)
+	}
+
+	waiting := false
+	for {
+		locked, err := q.TryAdvisoryLock(ctx, key)
+		if err != nil {
+			unlock()
+			return nil, fmt.Errorf("taking migration lock: %w", err)
+		}
+
+		if locked {
+			return unlock, nil
+		}
+
+		if !waiting {
+			logger.Info("waiting for another process to finish migrating")
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			unlock()
+			return nil, fmt.Errorf("timed out waiting for migration lock: %w", ctx.Err())
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- service_usage_daily records how many spans, and approximately how many
+-- bytes, each service has written per day. Rows are accumulated by every
+-- writer, so the totals are correct regardless of the number of replicas.
+CREATE TABLE service_usage_daily (
+  day DATE NOT NULL,
+  service_id BIGINT REFERENCES services(id) NOT NULL,
+  spans BIGINT NOT NULL,
+  bytes BIGINT NOT NULL,
+
+  PRIMARY KEY (day, service_id)
+);
+
+-- +goose Down
+
+DROP TABLE service_usage_daily;
@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- tenant holds the jaeger tenant a row belongs to. Deployments without
+-- multi-tenancy store everything under the empty tenant.
+ALTER TABLE services ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE services DROP CONSTRAINT services_name_key;
+ALTER TABLE services ADD CONSTRAINT services_tenant_name_key UNIQUE (tenant, name);
+
+ALTER TABLE operations ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE spans ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+
+-- every read filters on the tenant, so it leads the lookup indexes. the
+-- indexes on start_time alone stay for the cleaner, which spans tenants.
+DROP INDEX idx_trace_id;
+CREATE INDEX idx_spans_tenant_trace_id ON spans (tenant, trace_id);
+CREATE INDEX idx_spans_tenant_service_start_time ON spans (tenant, service_id, start_time);
+CREATE INDEX idx_spans_tenant_start_time ON spans (tenant, start_time);
+
+-- +goose Down
+
+DROP INDEX idx_spans_tenant_start_time;
+DROP INDEX idx_spans_tenant_service_start_time;
+DROP INDEX idx_spans_tenant_trace_id;
+CREATE INDEX idx_trace_id ON spans (trace_id);
+
+ALTER TABLE spans DROP COLUMN tenant;
+
+ALTER TABLE operations DROP COLUMN tenant;
+
+ALTER TABLE services DROP CONSTRAINT services_tenant_name_key;
+ALTER TABLE services DROP COLUMN tenant;
+ALTER TABLE services ADD CONSTRAINT services_name_key UNIQUE (name);
@@ -0,0 +1,72 @@
+package sql_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sqltest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	conn, _, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	databaseURL := conn.Config().ConnString()
+
+	t.Run("should be at the latest version", func(t *testing.T) {
+		current, latest, err := sql.MigrationVersions(slog.Default(), databaseURL)
+		require.Nil(t, err)
+
+		require.Greater(t, latest, int64(0))
+		require.Equal(t, latest, current)
+	})
+
+	t.Run("should read the schema version like goose", func(t *testing.T) {
+		latest, err := sql.LatestMigration()
+		require.Nil(t, err)
+
+		current, err := sql.New(conn).GetSchemaVersion(ctx)
+		require.Nil(t, err)
+		require.Equal(t, latest, current)
+	})
+
+	t.Run("should roll back and reapply migrations", func(t *testing.T) {
+		_, latest, err := sql.MigrationVersions(slog.Default(), databaseURL)
+		require.Nil(t, err)
+
+		err = sql.MigrateDown(slog.Default(), databaseURL)
+		require.Nil(t, err)
+
+		current, _, err := sql.MigrationVersions(slog.Default(), databaseURL)
+		require.Nil(t, err)
+		require.Less(t, current, latest)
+
+		err = sql.MigrateUpTo(slog.Default(), databaseURL, latest)
+		require.Nil(t, err)
+
+		current, _, err = sql.MigrationVersions(slog.Default(), databaseURL)
+		require.Nil(t, err)
+		require.Equal(t, latest, current)
+	})
+
+	t.Run("should refuse a database migrated by a newer version", func(t *testing.T) {
+		_, latest, err := sql.MigrationVersions(slog.Default(), databaseURL)
+		require.Nil(t, err)
+
+		_, err = conn.Exec(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, TRUE)", latest+1)
+		require.Nil(t, err)
+
+		defer func() {
+			_, err := conn.Exec(ctx, "DELETE FROM goose_db_version WHERE version_id = $1", latest+1)
+			require.Nil(t, err)
+		}()
+
+		err = sql.Migrate(slog.Default(), databaseURL)
+		require.ErrorIs(t, err, sql.ErrSchemaTooNew)
+	})
+}
@@ -2,24 +2,90 @@ package sql
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cleanServiceSpans = `-- name: CleanServiceSpans :execrows
+
+DELETE FROM spans
+USING services
+WHERE
+  spans.service_id = services.id AND
+  services.tenant = $1::TEXT AND
+  services.name = $2::TEXT
+`
+
+type CleanServiceSpansParams struct {
+	Tenant      string
+	ServiceName string
+}
+
+func (q *Queries) CleanServiceSpans(ctx context.Context, arg CleanServiceSpansParams) (int64, error) {
+	result, err := q.db.Exec(ctx, cleanServiceSpans, arg.Tenant, arg.ServiceName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const cleanSpans = `-- name: CleanSpans :execrows
 
 DELETE FROM spans
-WHERE spans.start_time < $1::TIMESTAMP
+WHERE
+  spans.start_time < $1::TIMESTAMP AND
+  NOT (spans.tenant = ANY($2::TEXT[]))
+`
+
+type CleanSpansParams struct {
+	PruneBefore     pgtype.Timestamp
+	ExcludedTenants []string
+}
+
+func (q *Queries) CleanSpans(ctx context.Context, arg CleanSpansParams) (int64, error) {
+	result, err := q.db.Exec(ctx, cleanSpans, arg.PruneBefore, arg.ExcludedTenants)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const cleanTenantSpans = `-- name: CleanTenantSpans :execrows
+
+DELETE FROM spans
+WHERE
+  spans.tenant = $1::TEXT AND
+  spans.start_time < $2::TIMESTAMP
 `
 
-func (q *Queries) CleanSpans(ctx context.Context, pruneBefore pgtype.Timestamp) (int64, error) {
-	result, err := q.db.Exec(ctx, cleanSpans, pruneBefore)
+type CleanTenantSpansParams struct {
+	Tenant      string
+	PruneBefore pgtype.Timestamp
+}
+
+func (q *Queries) CleanTenantSpans(ctx context.Context, arg CleanTenantSpansParams) (int64, error) {
+	result, err := q.db.Exec(ctx, cleanTenantSpans, arg.Tenant, arg.PruneBefore)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected(), nil
 }
 
+const countServiceOperations = `-- name: CountServiceOperations :one
+SELECT COUNT(*)
+FROM operations
+WHERE service_id = $1::BIGINT
+`
+
+func (q *Queries) CountServiceOperations(ctx context.Context, serviceID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countServiceOperations, serviceID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const findTraceIDs = `-- name: FindTraceIDs :many
 
 SELECT DISTINCT spans.trace_id as trace_id
@@ -27,6 +93,7 @@ FROM spans
     INNER JOIN operations ON (operations.id = spans.operation_id)
     INNER JOIN services ON (services.id = spans.service_id)
 WHERE
+    spans.tenant = $16::TEXT AND
     (services.name = $1::VARCHAR OR $2::BOOLEAN = FALSE) AND
     (operations.name = $3::VARCHAR OR $4::BOOLEAN = FALSE) AND
     (start_time >= $5::TIMESTAMP OR $6::BOOLEAN = FALSE) AND
@@ -57,6 +124,7 @@ type FindTraceIDsParams struct {
 	Tags                         map[string]string
 	TagsEnableFilter             bool
 	NumTraces                    int32
+	Tenant                       string
 }
 
 func formatTags(tags map[string]string) []TagContent {
@@ -70,10 +138,10 @@ func formatTags(tags map[string]string) []TagContent {
 	return parsedTags
 }
 
-func (q *Queries) FindTraceIDs(ctx context.Context, arg FindTraceIDsParams) ([][]byte, error) {
+func findTraceIDsArgs(arg FindTraceIDsParams) []any {
 	tags := formatTags(arg.Tags)
 
-	rows, err := q.db.Query(ctx, findTraceIDs,
+	return []any{
 		arg.ServiceName,
 		arg.ServiceNameEnableFilter,
 		arg.OperationName,
@@ -89,7 +157,12 @@ func (q *Queries) FindTraceIDs(ctx context.Context, arg FindTraceIDsParams) ([][
 		tags,
 		arg.TagsEnableFilter,
 		arg.NumTraces,
-	)
+		arg.Tenant,
+	}
+}
+
+func (q *Queries) FindTraceIDs(ctx context.Context, arg FindTraceIDsParams) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, findTraceIDs, findTraceIDsArgs(arg)...)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +181,30 @@ func (q *Queries) FindTraceIDs(ctx context.Context, arg FindTraceIDsParams) ([][
 	return items, nil
 }
 
+// EstimateFindTraceIDsCost returns the planner's estimate of the total cost
+// of FindTraceIDs with the arguments, without running it.
+func (q *Queries) EstimateFindTraceIDsCost(ctx context.Context, arg FindTraceIDsParams) (float64, error) {
+	row := q.db.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+findTraceIDs, findTraceIDsArgs(arg)...)
+	var explain []byte
+	if err := row.Scan(&explain); err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(explain, &plans); err != nil {
+		return 0, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+
+	return plans[0].Plan.TotalCost, nil
+}
+
 const getOperationID = `-- name: GetOperationID :one
 SELECT id 
 FROM operations 
@@ -134,17 +231,24 @@ const getOperations = `-- name: GetOperations :many
 SELECT operations.name, operations.kind
 FROM operations
   INNER JOIN services ON (operations.service_id = services.id)
-WHERE services.name = $1::VARCHAR
+WHERE
+  services.tenant = $1::TEXT AND
+  services.name = $2::VARCHAR
 ORDER BY operations.name ASC
 `
 
+type GetOperationsParams struct {
+	Tenant      string
+	ServiceName string
+}
+
 type GetOperationsRow struct {
 	Name string
 	Kind Spankind
 }
 
-func (q *Queries) GetOperations(ctx context.Context, serviceName string) ([]GetOperationsRow, error) {
-	rows, err := q.db.Query(ctx, getOperations, serviceName)
+func (q *Queries) GetOperations(ctx context.Context, arg GetOperationsParams) ([]GetOperationsRow, error) {
+	rows, err := q.db.Query(ctx, getOperations, arg.Tenant, arg.ServiceName)
 	if err != nil {
 		return nil, err
 	}
@@ -166,24 +270,67 @@ func (q *Queries) GetOperations(ctx context.Context, serviceName string) ([]GetO
 const getServiceID = `-- name: GetServiceID :one
 SELECT id
 FROM services
-WHERE name = $1::TEXT
+WHERE
+  tenant = $1::TEXT AND
+  name = $2::TEXT
 `
 
-func (q *Queries) GetServiceID(ctx context.Context, name string) (int64, error) {
-	row := q.db.QueryRow(ctx, getServiceID, name)
+type GetServiceIDParams struct {
+	Tenant string
+	Name   string
+}
+
+func (q *Queries) GetServiceID(ctx context.Context, arg GetServiceIDParams) (int64, error) {
+	row := q.db.QueryRow(ctx, getServiceID, arg.Tenant, arg.Name)
 	var id int64
 	err := row.Scan(&id)
 	return id, err
 }
 
+const getServiceUsage = `-- name: GetServiceUsage :many
+SELECT services.tenant, services.name, service_usage_daily.spans, service_usage_daily.bytes
+FROM service_usage_daily
+  INNER JOIN services ON (service_usage_daily.service_id = services.id)
+WHERE service_usage_daily.day = $1::DATE
+ORDER BY services.tenant ASC, services.name ASC
+`
+
+type GetServiceUsageRow struct {
+	Tenant string
+	Name   string
+	Spans  int64
+	Bytes  int64
+}
+
+func (q *Queries) GetServiceUsage(ctx context.Context, day pgtype.Date) ([]GetServiceUsageRow, error) {
+	rows, err := q.db.Query(ctx, getServiceUsage, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetServiceUsageRow
+	for rows.Next() {
+		var i GetServiceUsageRow
+		if err := rows.Scan(&i.Tenant, &i.Name, &i.Spans, &i.Bytes); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getServices = `-- name: GetServices :many
 SELECT services.name
 FROM services
+WHERE services.tenant = $1::TEXT
 ORDER BY services.name ASC
 `
 
-func (q *Queries) GetServices(ctx context.Context) ([]string, error) {
-	rows, err := q.db.Query(ctx, getServices)
+func (q *Queries) GetServices(ctx context.Context, tenant string) ([]string, error) {
+	rows, err := q.db.Query(ctx, getServices, tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -202,30 +349,6 @@ func (q *Queries) GetServices(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
-const getSpansCount = `-- name: GetSpansCount :one
-
-SELECT COUNT(*) FROM spans
-`
-
-func (q *Queries) GetSpansCount(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getSpansCount)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
-}
-
-const getSpansDiskSize = `-- name: GetSpansDiskSize :one
-
-SELECT pg_total_relation_size('spans')
-`
-
-func (q *Queries) GetSpansDiskSize(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getSpansDiskSize)
-	var pg_total_relation_size int64
-	err := row.Scan(&pg_total_relation_size)
-	return pg_total_relation_size, err
-}
-
 const getTraceSpans = `-- name: GetTraceSpans :many
 SELECT
   spans.span_id as span_id,
@@ -245,9 +368,16 @@ SELECT
 FROM spans 
   INNER JOIN operations ON (spans.operation_id = operations.id)
   INNER JOIN services ON (spans.service_id = services.id)
-WHERE trace_id = $1::BYTEA
+WHERE
+  spans.tenant = $1::TEXT AND
+  spans.trace_id = $2::BYTEA
 `
 
+type GetTraceSpansParams struct {
+	Tenant  string
+	TraceID []byte
+}
+
 type GetTraceSpansRow struct {
 	SpanID        []byte
 	TraceID       []byte
@@ -265,8 +395,8 @@ type GetTraceSpansRow struct {
 	Refs          []byte
 }
 
-func (q *Queries) GetTraceSpans(ctx context.Context, traceID []byte) ([]GetTraceSpansRow, error) {
-	rows, err := q.db.Query(ctx, getTraceSpans, traceID)
+func (q *Queries) GetTraceSpans(ctx context.Context, arg GetTraceSpansParams) ([]GetTraceSpansRow, error) {
+	rows, err := q.db.Query(ctx, getTraceSpans, arg.Tenant, arg.TraceID)
 	if err != nil {
 		return nil, err
 	}
@@ -315,7 +445,8 @@ INSERT INTO spans (
   warnings,
   kind,
   logs,
-  refs
+  refs,
+  tenant
 )
 VALUES(
   $1::BYTEA,
@@ -331,7 +462,8 @@ VALUES(
   $11::TEXT[],
   $12::SPANKIND,
   $13::JSONB,
-  $14::JSONB
+  $14::JSONB,
+  $15::TEXT
 )
 RETURNING spans.hack_id
 `
@@ -351,6 +483,7 @@ type InsertSpanParams struct {
 	Kind        Spankind
 	Logs        []byte
 	Refs        []byte
+	Tenant      string
 }
 
 func (q *Queries) InsertSpan(ctx context.Context, arg InsertSpanParams) (int64, error) {
@@ -369,6 +502,7 @@ func (q *Queries) InsertSpan(ctx context.Context, arg InsertSpanParams) (int64,
 		arg.Kind,
 		arg.Logs,
 		arg.Refs,
+		arg.Tenant,
 	)
 	var hack_id int64
 	err := row.Scan(&hack_id)
@@ -376,11 +510,12 @@ func (q *Queries) InsertSpan(ctx context.Context, arg InsertSpanParams) (int64,
 }
 
 const upsertOperation = `-- name: UpsertOperation :exec
-INSERT INTO operations (name, service_id, kind) 
+INSERT INTO operations (name, service_id, kind, tenant) 
 VALUES (
   $1::TEXT, 
   $2::BIGINT, 
-  $3::SPANKIND
+  $3::SPANKIND,
+  $4::TEXT
 ) ON CONFLICT(name, service_id, kind) DO NOTHING RETURNING id
 `
 
@@ -388,20 +523,55 @@ type UpsertOperationParams struct {
 	Name      string
 	ServiceID int64
 	Kind      Spankind
+	Tenant    string
 }
 
 func (q *Queries) UpsertOperation(ctx context.Context, arg UpsertOperationParams) error {
-	_, err := q.db.Exec(ctx, upsertOperation, arg.Name, arg.ServiceID, arg.Kind)
+	_, err := q.db.Exec(ctx, upsertOperation, arg.Name, arg.ServiceID, arg.Kind, arg.Tenant)
+	return err
+}
+
+const upsertServiceUsage = `-- name: UpsertServiceUsage :exec
+INSERT INTO service_usage_daily (day, service_id, spans, bytes)
+VALUES (
+  $1::DATE,
+  $2::BIGINT,
+  $3::BIGINT,
+  $4::BIGINT
+) ON CONFLICT(day, service_id) DO UPDATE SET
+  spans = service_usage_daily.spans + EXCLUDED.spans,
+  bytes = service_usage_daily.bytes + EXCLUDED.bytes
+`
+
+type UpsertServiceUsageParams struct {
+	Day       pgtype.Date
+	ServiceID int64
+	Spans     int64
+	Bytes     int64
+}
+
+func (q *Queries) UpsertServiceUsage(ctx context.Context, arg UpsertServiceUsageParams) error {
+	_, err := q.db.Exec(ctx, upsertServiceUsage,
+		arg.Day,
+		arg.ServiceID,
+		arg.Spans,
+		arg.Bytes,
+	)
 	return err
 }
 
 const upsertService = `-- name: UpsertService :exec
 
 
-INSERT INTO services (name) 
-VALUES ($1::VARCHAR) ON CONFLICT(name) DO NOTHING RETURNING id
+INSERT INTO services (tenant, name) 
+VALUES ($1::TEXT, $2::VARCHAR) ON CONFLICT(tenant, name) DO NOTHING RETURNING id
 `
 
+type UpsertServiceParams struct {
+	Tenant string
+	Name   string
+}
+
 // -- name: GetDependencies :many
 // SELECT
 //
@@ -436,7 +606,7 @@ VALUES ($1::VARCHAR) ON CONFLICT(name) DO NOTHING RETURNING id
 //
 // ;
 // LIMIT sqlc.arg(limit)::INT;
-func (q *Queries) UpsertService(ctx context.Context, name string) error {
-	_, err := q.db.Exec(ctx, upsertService, name)
+func (q *Queries) UpsertService(ctx context.Context, arg UpsertServiceParams) error {
+	_, err := q.db.Exec(ctx, upsertService, arg.Tenant, arg.Name)
 	return err
 }
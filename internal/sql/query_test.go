@@ -22,10 +22,10 @@ func TestGetOperations(t *testing.T) {
 	t.Run("should return nothing when no operations exist", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "service-1")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "service-1"})
 		require.Nil(t, err)
 
-		operations, err := q.GetOperations(ctx, "service-1")
+		operations, err := q.GetOperations(ctx, sql.GetOperationsParams{ServiceName: "service-1"})
 		require.Nil(t, err)
 
 		require.Empty(t, operations)
@@ -34,10 +34,10 @@ func TestGetOperations(t *testing.T) {
 	t.Run("should not return operations from another service", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "service-1")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "service-1"})
 		require.Nil(t, err)
 
-		serviceID, err := q.GetServiceID(ctx, "service-1")
+		serviceID, err := q.GetServiceID(ctx, sql.GetServiceIDParams{Name: "service-1"})
 		require.Nil(t, err)
 
 		err = q.UpsertOperation(ctx, sql.UpsertOperationParams{
@@ -47,7 +47,7 @@ func TestGetOperations(t *testing.T) {
 		})
 		require.Nil(t, err)
 
-		operations, err := q.GetOperations(ctx, "service-2")
+		operations, err := q.GetOperations(ctx, sql.GetOperationsParams{ServiceName: "service-2"})
 		require.Nil(t, err)
 
 		require.Len(t, operations, 0)
@@ -56,10 +56,10 @@ func TestGetOperations(t *testing.T) {
 	t.Run("should return something when an operation exists", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "service-1")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "service-1"})
 		require.Nil(t, err)
 
-		serviceID, err := q.GetServiceID(ctx, "service-1")
+		serviceID, err := q.GetServiceID(ctx, sql.GetServiceIDParams{Name: "service-1"})
 		require.Nil(t, err)
 
 		err = q.UpsertOperation(ctx, sql.UpsertOperationParams{
@@ -69,7 +69,7 @@ func TestGetOperations(t *testing.T) {
 		})
 		require.Nil(t, err)
 
-		operations, err := q.GetOperations(ctx, "service-1")
+		operations, err := q.GetOperations(ctx, sql.GetOperationsParams{ServiceName: "service-1"})
 		require.Nil(t, err)
 
 		require.Equal(t, []sql.GetOperationsRow{{Name: "Something", Kind: sql.SpankindClient}}, operations)
@@ -86,7 +86,7 @@ func TestGetServices(t *testing.T) {
 	t.Run("should return nothing when no services exist", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		services, err := q.GetServices(ctx)
+		services, err := q.GetServices(ctx, "")
 		require.Nil(t, err)
 
 		require.Empty(t, services)
@@ -95,15 +95,15 @@ func TestGetServices(t *testing.T) {
 	t.Run("should return something when an services exists", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "Something")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "Something"})
 		require.Nil(t, err)
 
-		serviceID, err := q.GetServiceID(ctx, "Something")
+		serviceID, err := q.GetServiceID(ctx, sql.GetServiceIDParams{Name: "Something"})
 		require.Nil(t, err)
 
 		require.NotNil(t, serviceID)
 
-		services, err := q.GetServices(ctx)
+		services, err := q.GetServices(ctx, "")
 		require.Nil(t, err)
 
 		require.Equal(t, []string{"Something"}, services)
@@ -120,10 +120,10 @@ func TestSpans(t *testing.T) {
 	t.Run("should be able to write a span", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "service-1")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "service-1"})
 		require.Nil(t, err)
 
-		serviceID, err := q.GetServiceID(ctx, "service-1")
+		serviceID, err := q.GetServiceID(ctx, sql.GetServiceIDParams{Name: "service-1"})
 		require.Nil(t, err)
 
 		err = q.UpsertOperation(ctx, sql.UpsertOperationParams{Name: "operation-1", ServiceID: serviceID, Kind: sql.SpankindClient})
@@ -186,7 +186,7 @@ func TestSpans(t *testing.T) {
 		})
 		require.Nil(t, err)
 
-		queried, err := q.GetTraceSpans(ctx, []byte{0, 0, 0, 0})
+		queried, err := q.GetTraceSpans(ctx, sql.GetTraceSpansParams{TraceID: []byte{0, 0, 0, 0}})
 		require.Nil(t, err)
 
 		_ = queried
@@ -196,10 +196,10 @@ func TestSpans(t *testing.T) {
 	t.Run("should limit the number of traces returned according to num_traces", func(t *testing.T) {
 		require.Nil(t, cleanup())
 
-		err := q.UpsertService(ctx, "service-1")
+		err := q.UpsertService(ctx, sql.UpsertServiceParams{Name: "service-1"})
 		require.Nil(t, err)
 
-		serviceID, err := q.GetServiceID(ctx, "service-1")
+		serviceID, err := q.GetServiceID(ctx, sql.GetServiceIDParams{Name: "service-1"})
 		require.Nil(t, err)
 
 		err = q.UpsertOperation(ctx, sql.UpsertOperationParams{Name: "operation-1", ServiceID: serviceID, Kind: sql.SpankindClient})
@@ -277,4 +277,11 @@ func TestSpans(t *testing.T) {
 
 		require.Len(t, queried, 2)
 	})
+
+	t.Run("should estimate the cost of finding trace ids", func(t *testing.T) {
+		cost, err := q.EstimateFindTraceIDsCost(ctx, sql.FindTraceIDsParams{NumTraces: 20})
+		require.Nil(t, err)
+
+		require.Greater(t, cost, float64(0))
+	})
 }
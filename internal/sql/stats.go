@@ -0,0 +1,104 @@
+package sql
+
+import (
+	"context"
+)
+
+const getTableStats = `-- name: GetTableStats :many
+SELECT
+  pg_stat_user_tables.relname::TEXT AS table_name,
+  (CASE
+    WHEN pg_class.reltuples < 0 THEN pg_stat_user_tables.n_live_tup
+    ELSE pg_class.reltuples
+  END)::BIGINT AS row_estimate,
+  pg_table_size(pg_class.oid) AS table_bytes,
+  pg_indexes_size(pg_class.oid) AS indexes_bytes,
+  pg_total_relation_size(pg_class.oid) AS total_bytes
+FROM pg_stat_user_tables
+  INNER JOIN pg_class ON (pg_class.oid = pg_stat_user_tables.relid)
+WHERE pg_stat_user_tables.relname = ANY($1::TEXT[])
+  AND pg_stat_user_tables.schemaname = current_schema()
+`
+
+type GetTableStatsRow struct {
+	TableName    string
+	RowEstimate  int64
+	TableBytes   int64
+	IndexesBytes int64
+	TotalBytes   int64
+}
+
+// GetTableStats returns size and row estimates for the given tables. Row
+// counts come from the planner statistics rather than a scan, so they are
+// cheap to query but only as fresh as the last ANALYZE.
+func (q *Queries) GetTableStats(ctx context.Context, tables []string) ([]GetTableStatsRow, error) {
+	rows, err := q.db.Query(ctx, getTableStats, tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTableStatsRow
+	for rows.Next() {
+		var i GetTableStatsRow
+		if err := rows.Scan(
+			&i.TableName,
+			&i.RowEstimate,
+			&i.TableBytes,
+			&i.IndexesBytes,
+			&i.TotalBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIndexStats = `-- name: GetIndexStats :many
+SELECT
+  pg_stat_user_indexes.relname::TEXT AS table_name,
+  pg_stat_user_indexes.indexrelname::TEXT AS index_name,
+  pg_relation_size(pg_stat_user_indexes.indexrelid) AS index_bytes,
+  pg_stat_user_indexes.idx_scan AS scans,
+  pg_stat_user_indexes.idx_tup_read AS tuples_read
+FROM pg_stat_user_indexes
+WHERE pg_stat_user_indexes.relname = ANY($1::TEXT[])
+  AND pg_stat_user_indexes.schemaname = current_schema()
+`
+
+type GetIndexStatsRow struct {
+	TableName  string
+	IndexName  string
+	IndexBytes int64
+	Scans      int64
+	TuplesRead int64
+}
+
+func (q *Queries) GetIndexStats(ctx context.Context, tables []string) ([]GetIndexStatsRow, error) {
+	rows, err := q.db.Query(ctx, getIndexStats, tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetIndexStatsRow
+	for rows.Next() {
+		var i GetIndexStatsRow
+		if err := rows.Scan(
+			&i.TableName,
+			&i.IndexName,
+			&i.IndexBytes,
+			&i.Scans,
+			&i.TuplesRead,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,71 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sqltest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	q := sql.New(conn)
+
+	t.Run("should return table stats", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		stats, err := q.GetTableStats(ctx, []string{"spans"})
+		require.Nil(t, err)
+
+		require.Len(t, stats, 1)
+		require.Equal(t, "spans", stats[0].TableName)
+		require.GreaterOrEqual(t, stats[0].RowEstimate, int64(0))
+	})
+
+	t.Run("should return index stats", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		stats, err := q.GetIndexStats(ctx, []string{"services"})
+		require.Nil(t, err)
+
+		var indexes []string
+		for _, stat := range stats {
+			indexes = append(indexes, stat.IndexName)
+		}
+
+		require.Contains(t, indexes, "idx_services_name")
+	})
+
+	t.Run("should index spans by tenant", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		stats, err := q.GetIndexStats(ctx, []string{"spans"})
+		require.Nil(t, err)
+
+		var indexes []string
+		for _, stat := range stats {
+			indexes = append(indexes, stat.IndexName)
+		}
+
+		require.Contains(t, indexes, "idx_spans_tenant_trace_id")
+		require.Contains(t, indexes, "idx_spans_tenant_service_start_time")
+		require.Contains(t, indexes, "idx_spans_tenant_start_time")
+		require.NotContains(t, indexes, "idx_trace_id")
+	})
+
+	t.Run("should take and release an advisory lock", func(t *testing.T) {
+		locked, err := q.TryAdvisoryLock(ctx, 42)
+		require.Nil(t, err)
+		require.True(t, locked)
+
+		unlocked, err := q.AdvisoryUnlock(ctx, 42)
+		require.Nil(t, err)
+		require.True(t, unlocked)
+	})
+}
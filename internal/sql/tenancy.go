@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+)
+
+// TenantSetting is the run-time parameter that the row level security
+// policies compare the tenant column against.
+const TenantSetting = "jaeger_postgresql.tenant"
+
+// tenantTables are the tables that carry a tenant column.
+var tenantTables = []string{"spans", "services", "operations"}
+
+const setTenant = `-- name: SetTenant :exec
+SELECT set_config($1::TEXT, $2::TEXT, FALSE)
+`
+
+// SetTenant sets the tenant that row level security policies allow the
+// session to see. It lasts until the connection is closed or it is set again.
+func (q *Queries) SetTenant(ctx context.Context, tenant string) error {
+	_, err := q.db.Exec(ctx, setTenant, TenantSetting, tenant)
+	return err
+}
+
+const getRowLevelSecurity = `-- name: GetRowLevelSecurity :one
+SELECT relrowsecurity
+FROM pg_class
+WHERE oid = 'spans'::regclass
+`
+
+// GetRowLevelSecurity reports whether the tenant isolation policies are
+// enabled.
+func (q *Queries) GetRowLevelSecurity(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, getRowLevelSecurity)
+	var enabled bool
+	err := row.Scan(&enabled)
+	return enabled, err
+}
+
+const getCurrentRole = `-- name: GetCurrentRole :one
+SELECT rolname::TEXT, (rolsuper OR rolbypassrls) AS bypass_rls
+FROM pg_roles
+WHERE rolname = current_user
+`
+
+type GetCurrentRoleRow struct {
+	Name      string
+	BypassRls bool
+}
+
+// GetCurrentRole returns the role the session runs as, and whether row level
+// security policies apply to it.
+func (q *Queries) GetCurrentRole(ctx context.Context) (GetCurrentRoleRow, error) {
+	row := q.db.QueryRow(ctx, getCurrentRole)
+	var i GetCurrentRoleRow
+	err := row.Scan(&i.Name, &i.BypassRls)
+	return i, err
+}
+
+// SetRowLevelSecurity enables or disables the tenant isolation policies. The
+// tables are only altered when their state differs, as ALTER TABLE takes an
+// exclusive lock. The policies are forced, so they restrict the table owner
+// too; only superusers and roles with BYPASSRLS are exempt. The cleaner deletes
+// the spans of every tenant, so it must run as such a role, which it checks
+// with GetCurrentRole on startup.
+func (q *Queries) SetRowLevelSecurity(ctx context.Context, enabled bool) error {
+	current, err := q.GetRowLevelSecurity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get row level security state: %w", err)
+	}
+
+	if current == enabled {
+		return nil
+	}
+
+	for _, table := range tenantTables {
+		var statements []string
+		if enabled {
+			statements = []string{
+				fmt.Sprintf("DROP POLICY IF EXISTS tenant_isolation ON %s", table),
+				fmt.Sprintf("CREATE POLICY tenant_isolation ON %s USING (tenant = current_setting('%s', TRUE)) WITH CHECK (tenant = current_setting('%s', TRUE))", table, TenantSetting, TenantSetting),
+				fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", table),
+				fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", table),
+			}
+		} else {
+			statements = []string{
+				fmt.Sprintf("ALTER TABLE %s NO FORCE ROW LEVEL SECURITY", table),
+				fmt.Sprintf("ALTER TABLE %s DISABLE ROW LEVEL SECURITY", table),
+				fmt.Sprintf("DROP POLICY IF EXISTS tenant_isolation ON %s", table),
+			}
+		}
+
+		for _, statement := range statements {
+			if _, err := q.db.Exec(ctx, statement); err != nil {
+				return fmt.Errorf("failed to alter row level security of %s: %w", table, err)
+			}
+		}
+	}
+
+	return nil
+}
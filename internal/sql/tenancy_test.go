@@ -0,0 +1,56 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sqltest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowLevelSecurity(t *testing.T) {
+	ctx := context.Background()
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	q := sql.New(conn)
+
+	t.Run("should enable and disable the policies", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		require.Nil(t, q.SetRowLevelSecurity(ctx, true))
+		enabled, err := q.GetRowLevelSecurity(ctx)
+		require.Nil(t, err)
+		require.True(t, enabled)
+
+		require.Nil(t, q.SetRowLevelSecurity(ctx, false))
+		enabled, err = q.GetRowLevelSecurity(ctx)
+		require.Nil(t, err)
+		require.False(t, enabled)
+	})
+
+	t.Run("should report whether the role bypasses the policies", func(t *testing.T) {
+		require.Nil(t, cleanup())
+
+		// the harness connects as a superuser
+		role, err := q.GetCurrentRole(ctx)
+		require.Nil(t, err)
+		require.True(t, role.BypassRls)
+
+		tx, err := conn.Begin(ctx)
+		require.Nil(t, err)
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Exec(ctx, "CREATE ROLE restricted NOLOGIN NOBYPASSRLS")
+		require.Nil(t, err)
+		_, err = tx.Exec(ctx, "SET LOCAL ROLE restricted")
+		require.Nil(t, err)
+
+		role, err = sql.New(tx).GetCurrentRole(ctx)
+		require.Nil(t, err)
+		require.Equal(t, "restricted", role.Name)
+		require.False(t, role.BypassRls)
+	})
+}
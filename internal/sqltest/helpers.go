@@ -17,7 +17,7 @@ import (
 
 func TruncateAll(conn *pgx.Conn) error {
 	ctx := context.Background()
-	tables := []string{"operations", "services", "spans"}
+	tables := []string{"operations", "services", "spans", "service_usage_daily"}
 	for _, table := range tables {
 		if _, err := conn.Exec(ctx, fmt.Sprintf("TRUNCATE %s CASCADE", table)); err != nil {
 			return err
@@ -0,0 +1,173 @@
+package stats
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockName names the advisory lock that elects the replica which collects
+// database statistics. The key is derived from it and the schema, so that
+// deployments in other schemas elect their own collector.
+const lockName = "stats_collector"
+
+// Source gathers one group of statistics from the database and publishes them.
+type Source interface {
+	Collect(ctx context.Context, q *sql.Queries) error
+}
+
+// SourceFunc adapts a function into a Source.
+type SourceFunc func(ctx context.Context, q *sql.Queries) error
+
+// Collect calls f(ctx, q).
+func (f SourceFunc) Collect(ctx context.Context, q *sql.Queries) error {
+	return f(ctx, q)
+}
+
+// Collector periodically collects statistics from its sources. When several
+// replicas share a database only the one holding the advisory lock collects,
+// so the statistics queries are issued once per interval per database rather
+// than once per replica.
+type Collector struct {
+	pool    *pgxpool.Pool
+	logger  *slog.Logger
+	sources map[string]Source
+
+	// election is whether the replicas elect a single collector
+	election bool
+
+	// conn is the connection holding the advisory lock, or nil if this
+	// replica is not the leader.
+	conn *pgxpool.Conn
+}
+
+// Option configures a Collector.
+type Option func(*Collector)
+
+// WithoutElection makes the collector collect on every replica rather than
+// elect one. The advisory lock is held by a session, so it cannot be relied on
+// when connections go through PgBouncer in transaction pooling mode.
+func WithoutElection() Option {
+	return func(c *Collector) {
+		c.election = false
+	}
+}
+
+// NewCollector returns a new Collector without any sources.
+func NewCollector(pool *pgxpool.Pool, logger *slog.Logger, opts ...Option) *Collector {
+	c := &Collector{
+		pool:     pool,
+		logger:   logger,
+		sources:  map[string]Source{},
+		election: true,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Register adds a source to the collector. It must be called before Run.
+func (c *Collector) Register(name string, source Source) {
+	c.sources[name] = source
+}
+
+// Run collects statistics every interval until the context is cancelled.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer c.resign()
+
+	for {
+		c.collect(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context) {
+	if !c.election {
+		c.collectFrom(ctx, sql.New(c.pool))
+		return
+	}
+
+	if c.conn == nil && !c.elect(ctx) {
+		return
+	}
+
+	c.collectFrom(ctx, sql.New(c.conn))
+
+	if c.conn.Conn().IsClosed() {
+		c.logger.Warn("lost stats collector connection")
+		c.resign()
+	}
+}
+
+func (c *Collector) collectFrom(ctx context.Context, q *sql.Queries) {
+	for name, source := range c.sources {
+		if err := source.Collect(ctx, q); err != nil {
+			c.logger.Error("failed to collect stats", "source", name, "err", err)
+		}
+	}
+}
+
+// elect tries to take the advisory lock, returning whether this replica is
+// now the leader.
+func (c *Collector) elect(ctx context.Context) bool {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		c.logger.Error("failed to acquire stats collector connection", "err", err)
+		return false
+	}
+
+	q := sql.New(conn)
+	key, err := q.SchemaLockKey(ctx, lockName)
+	if err != nil {
+		c.logger.Error("failed to derive stats collector lock key", "err", err)
+		conn.Release()
+		return false
+	}
+
+	locked, err := q.TryAdvisoryLock(ctx, key)
+	if err != nil {
+		c.logger.Error("failed to take stats collector lock", "err", err)
+		conn.Release()
+		return false
+	}
+
+	if !locked {
+		conn.Release()
+		return false
+	}
+
+	c.logger.Info("elected as stats collector")
+	c.conn = conn
+	return true
+}
+
+// resign gives up the advisory lock. The connection is closed rather than
+// returned to the pool, which releases the lock even if it can no longer be
+// unlocked explicitly.
+func (c *Collector) resign() {
+	if c.conn == nil {
+		return
+	}
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancelFn()
+
+	if err := c.conn.Hijack().Close(ctx); err != nil {
+		c.logger.Warn("failed to close stats collector connection", "err", err)
+	}
+
+	c.conn = nil
+}
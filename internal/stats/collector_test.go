@@ -0,0 +1,35 @@
+package stats
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	t.Run("should collect without taking the lock when election is disabled", func(t *testing.T) {
+		// nothing listens here, so taking the lock would fail
+		pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/postgres?connect_timeout=1")
+		require.Nil(t, err)
+		defer pool.Close()
+
+		ctx, cancelFn := context.WithCancel(context.Background())
+		defer cancelFn()
+
+		collected := 0
+		c := NewCollector(pool, slog.Default(), WithoutElection())
+		c.Register("test", SourceFunc(func(ctx context.Context, q *sql.Queries) error {
+			collected++
+			cancelFn()
+			return nil
+		}))
+
+		c.Run(ctx, time.Hour)
+		require.Equal(t, 1, collected)
+	})
+}
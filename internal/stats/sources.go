@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	promNamespace = "jaeger_postgresql"
+)
+
+// Tables are the tables that statistics are collected for.
+var Tables = []string{"spans", "services", "operations"}
+
+var (
+	promSpansTableBytesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "spans_table_bytes",
+		Help:      "The size of the spans table in bytes",
+	})
+
+	promSpansCountGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "spans_count",
+		Help:      "The estimated number of spans",
+	})
+
+	promTableBytesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_bytes",
+		Help:      "The size of a table in bytes, excluding indexes",
+	}, []string{"table"})
+
+	promTableIndexesBytesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_indexes_bytes",
+		Help:      "The size of all indexes of a table in bytes",
+	}, []string{"table"})
+
+	promTableRowsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "table_rows_estimate",
+		Help:      "The planner's estimate of the number of rows in a table",
+	}, []string{"table"})
+
+	promIndexBytesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "index_bytes",
+		Help:      "The size of an index in bytes",
+	}, []string{"table", "index"})
+
+	promIndexScansGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "index_scans",
+		Help:      "The number of index scans initiated on an index since statistics were last reset",
+	}, []string{"table", "index"})
+
+	promIndexTuplesReadGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "index_tuples_read",
+		Help:      "The number of index entries returned by scans on an index since statistics were last reset",
+	}, []string{"table", "index"})
+)
+
+// TableStats returns a source that publishes table sizes and row estimates.
+func TableStats() Source {
+	return SourceFunc(func(ctx context.Context, q *sql.Queries) error {
+		stats, err := q.GetTableStats(ctx, Tables)
+		if err != nil {
+			return fmt.Errorf("failed to query table stats: %w", err)
+		}
+
+		for _, stat := range stats {
+			promTableBytesGauge.WithLabelValues(stat.TableName).Set(float64(stat.TableBytes))
+			promTableIndexesBytesGauge.WithLabelValues(stat.TableName).Set(float64(stat.IndexesBytes))
+			promTableRowsGauge.WithLabelValues(stat.TableName).Set(float64(stat.RowEstimate))
+
+			if stat.TableName == "spans" {
+				promSpansTableBytesGauge.Set(float64(stat.TotalBytes))
+				promSpansCountGauge.Set(float64(stat.RowEstimate))
+			}
+		}
+
+		return nil
+	})
+}
+
+// IndexStats returns a source that publishes index sizes and usage.
+func IndexStats() Source {
+	return SourceFunc(func(ctx context.Context, q *sql.Queries) error {
+		stats, err := q.GetIndexStats(ctx, Tables)
+		if err != nil {
+			return fmt.Errorf("failed to query index stats: %w", err)
+		}
+
+		for _, stat := range stats {
+			promIndexBytesGauge.WithLabelValues(stat.TableName, stat.IndexName).Set(float64(stat.IndexBytes))
+			promIndexScansGauge.WithLabelValues(stat.TableName, stat.IndexName).Set(float64(stat.Scans))
+			promIndexTuplesReadGauge.WithLabelValues(stat.TableName, stat.IndexName).Set(float64(stat.TuplesRead))
+		}
+
+		return nil
+	})
+}
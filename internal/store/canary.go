@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// CanaryServiceName is the reserved service name that canary spans are
+// written under. It is hidden from GetServices.
+const CanaryServiceName = "jaeger-postgresql-canary"
+
+type canaryKey struct{}
+
+// withCanary marks the context as the canary's own, whose writes are exempt
+// from quotas. The service name cannot tell, as any client may send it.
+func withCanary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, canaryKey{}, true)
+}
+
+// isCanary reports whether the context is the canary's own.
+func isCanary(ctx context.Context) bool {
+	canary, _ := ctx.Value(canaryKey{}).(bool)
+	return canary
+}
+
+const canaryOperationName = "canary"
+
+// canaryPollInterval is how often the canary trace is read while it is not
+// found, e.g. because a read replica lags behind.
+const canaryPollInterval = time.Millisecond * 100
+
+var (
+	promCanaryHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Name:      "canary_round_trip_seconds",
+		Help:      "The time from writing a canary span until it could be read back",
+	})
+
+	promCanaryFailuresCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "canary_failures_total",
+		Help:      "The total number of canary spans that failed to be written or read back",
+	})
+
+	promCanaryUpGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "canary_up",
+		Help:      "Whether the latest canary span was written and read back (1) or not (0)",
+	})
+)
+
+// Canary periodically writes a span and reads it back, to find out whether
+// spans can actually be stored and not just whether the database is up.
+type Canary struct {
+	writer  *Writer
+	reader  spanstore.Reader
+	q       *sql.Queries
+	logger  *slog.Logger
+	timeout time.Duration
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewCanary returns a Canary that writes through the writer, reads through the
+// reader and removes its spans with q, which must be able to write. A round
+// fails when it takes longer than timeout.
+func NewCanary(writer *Writer, reader spanstore.Reader, q *sql.Queries, logger *slog.Logger, timeout time.Duration) *Canary {
+	return &Canary{
+		writer:  writer,
+		reader:  reader,
+		q:       q,
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// Check returns the error of the latest round, or nil if it succeeded or no
+// round has finished yet.
+func (c *Canary) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastErr
+}
+
+// Run runs a round right away and then every interval, until the context is
+// done.
+func (c *Canary) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := c.round(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			promCanaryFailuresCounter.Inc()
+			promCanaryUpGauge.Set(0)
+			c.logger.Error("canary failed", "err", err)
+		} else {
+			promCanaryUpGauge.Set(1)
+		}
+
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// round writes a canary span, waits for it to be readable and removes it.
+func (c *Canary) round(ctx context.Context) error {
+	// canary spans are removed even when the round fails or times out,
+	// including those left behind by earlier rounds
+	defer func() {
+		cleanupCtx, cancelFn := context.WithTimeout(context.Background(), c.timeout)
+		defer cancelFn()
+
+		_, err := c.q.CleanServiceSpans(cleanupCtx, sql.CleanServiceSpansParams{
+			Tenant:      tenancy.GetTenant(ctx),
+			ServiceName: CanaryServiceName,
+		})
+		if err != nil {
+			c.logger.Warn("failed to remove canary spans", "err", err)
+		}
+	}()
+
+	ctx, cancelFn := context.WithTimeout(ctx, c.timeout)
+	defer cancelFn()
+
+	span := &model.Span{
+		TraceID:       model.NewTraceID(rand.Uint64(), rand.Uint64()),
+		SpanID:        model.NewSpanID(rand.Uint64()),
+		OperationName: canaryOperationName,
+		StartTime:     time.Now(),
+		Process:       model.NewProcess(CanaryServiceName, nil),
+	}
+
+	start := time.Now()
+	if err := c.writer.WriteSpan(withCanary(ctx), span); err != nil {
+		return fmt.Errorf("failed to write canary span: %w", err)
+	}
+
+	ticker := time.NewTicker(canaryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		trace, err := c.reader.GetTrace(ctx, span.TraceID)
+		if err == nil {
+			for _, s := range trace.Spans {
+				if s.SpanID == span.SpanID {
+					promCanaryHistogram.Observe(time.Since(start).Seconds())
+					return nil
+				}
+			}
+
+			err = fmt.Errorf("canary span missing from its trace")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to read back canary span: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
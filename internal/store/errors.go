@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kinds of storage errors. Errors returned by the reader and writer match
+// them with errors.Is, and carry the gRPC code of their kind, so that Jaeger
+// can show or retry them.
+var (
+	// ErrTraceNotFound is returned for traces without spans. It is Jaeger's
+	// own, which Jaeger maps to codes.NotFound.
+	ErrTraceNotFound = spanstore.ErrTraceNotFound
+
+	// ErrInvalidQuery is returned for queries and spans that are rejected as
+	// they are, e.g. by the search guardrails.
+	ErrInvalidQuery = errors.New("invalid query")
+
+	// ErrTimeout is returned when the query deadline or the statement timeout
+	// passes.
+	ErrTimeout = errors.New("query timed out")
+
+	// ErrCanceled is returned when the caller cancels the query.
+	ErrCanceled = errors.New("query canceled")
+
+	// ErrUnavailable is returned when the database cannot be reached, or does
+	// not accept connections for now. Retrying may succeed.
+	ErrUnavailable = errors.New("database unavailable")
+
+	// ErrDataCorruption is returned when stored spans cannot be decoded.
+	ErrDataCorruption = errors.New("stored data is corrupt")
+)
+
+// The codes of the PostgreSQL errors that are classified.
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgClassConnectionException = "08"
+	pgClassDataException       = "22"
+	pgQueryCanceled            = "57014"
+	pgAdminShutdown            = "57P01"
+	pgCrashShutdown            = "57P02"
+	pgCannotConnectNow         = "57P03"
+	pgTooManyConnections       = "53300"
+	pgDataCorrupted            = "XX001"
+	pgIndexCorrupted           = "XX002"
+)
+
+// Error is a storage error of one of the kinds above.
+type Error struct {
+	// Kind is one of the Err* kinds.
+	Kind error
+
+	// Err is the error that occurred.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap makes the error match both its kind and the error that occurred.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// GRPCStatus returns the status that the error is sent to Jaeger with.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(errorCode(e.Kind), e.Error())
+}
+
+// errorCode returns the gRPC code of a kind of error.
+func errorCode(kind error) codes.Code {
+	switch kind {
+	case ErrTraceNotFound:
+		return codes.NotFound
+	case ErrInvalidQuery:
+		return codes.InvalidArgument
+	case ErrTimeout:
+		return codes.DeadlineExceeded
+	case ErrCanceled:
+		return codes.Canceled
+	case ErrUnavailable:
+		return codes.Unavailable
+	case ErrDataCorruption:
+		return codes.DataLoss
+	default:
+		return codes.Unknown
+	}
+}
+
+// invalidQueryf returns an ErrInvalidQuery error with the formatted message.
+func invalidQueryf(format string, a ...any) error {
+	return &Error{Kind: ErrInvalidQuery, Err: fmt.Errorf(format, a...)}
+}
+
+// corrupt returns err as an ErrDataCorruption error.
+func corrupt(err error) error {
+	return &Error{Kind: ErrDataCorruption, Err: err}
+}
+
+// classify returns err as an error of the kind it is, or as it is if it is of
+// no known kind or already has a gRPC status.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+
+	return err
+}
+
+// errorKind returns the kind of err, or nil if it is of no known kind.
+func errorKind(err error) error {
+	if errors.Is(err, ErrTraceNotFound) {
+		return ErrTraceNotFound
+	}
+
+	// cancelling the context of a query also cancels the statement, so that
+	// the server reports it as canceled too
+	if errors.Is(err, context.Canceled) {
+		return ErrCanceled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return ErrTimeout
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == pgQueryCanceled:
+			return ErrTimeout
+		case strings.HasPrefix(pgErr.Code, pgClassConnectionException),
+			pgErr.Code == pgAdminShutdown,
+			pgErr.Code == pgCrashShutdown,
+			pgErr.Code == pgCannotConnectNow,
+			pgErr.Code == pgTooManyConnections:
+			return ErrUnavailable
+		case strings.HasPrefix(pgErr.Code, pgClassDataException):
+			return ErrInvalidQuery
+		case pgErr.Code == pgDataCorrupted, pgErr.Code == pgIndexCorrupted:
+			return ErrDataCorruption
+		default:
+			return nil
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return ErrUnavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+
+	return nil
+}
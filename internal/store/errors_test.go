@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	t.Run("should classify errors by kind", func(t *testing.T) {
+		for _, tc := range []struct {
+			err  error
+			kind error
+			code codes.Code
+		}{
+			{context.Canceled, ErrCanceled, codes.Canceled},
+			{context.DeadlineExceeded, ErrTimeout, codes.DeadlineExceeded},
+			{&pgconn.PgError{Code: "57014"}, ErrTimeout, codes.DeadlineExceeded},
+			{&pgconn.PgError{Code: "08006"}, ErrUnavailable, codes.Unavailable},
+			{&pgconn.PgError{Code: "57P01"}, ErrUnavailable, codes.Unavailable},
+			{&pgconn.PgError{Code: "53300"}, ErrUnavailable, codes.Unavailable},
+			{&pgconn.ConnectError{}, ErrUnavailable, codes.Unavailable},
+			{&pgconn.PgError{Code: "22007"}, ErrInvalidQuery, codes.InvalidArgument},
+			{&pgconn.PgError{Code: "XX001"}, ErrDataCorruption, codes.DataLoss},
+		} {
+			err := classify(fmt.Errorf("failed to query: %w", tc.err))
+
+			require.ErrorIs(t, err, tc.kind)
+			require.ErrorIs(t, err, tc.err)
+			require.Equal(t, tc.code, status.Code(err))
+			require.Equal(t, tc.code, status.Code(fmt.Errorf("wrapped: %w", err)))
+		}
+	})
+
+	t.Run("should leave other errors alone", func(t *testing.T) {
+		err := fmt.Errorf("failed to query: %w", &pgconn.PgError{Code: "42601"})
+		require.Equal(t, err, classify(err))
+		require.Equal(t, codes.Unknown, status.Code(classify(err)))
+
+		require.Nil(t, classify(nil))
+	})
+
+	t.Run("should keep the status of errors that have one", func(t *testing.T) {
+		require.Equal(t, errReadOnly, classify(errReadOnly))
+
+		err := invalidQueryf("too broad")
+		require.Equal(t, err, classify(err))
+	})
+
+	t.Run("should map not found traces to jaeger's error", func(t *testing.T) {
+		err := classify(spanstore.ErrTraceNotFound)
+		require.True(t, errors.Is(err, spanstore.ErrTraceNotFound))
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("should report data corruption", func(t *testing.T) {
+		err := corrupt(errors.New("failed to decode logs"))
+		require.ErrorIs(t, err, ErrDataCorruption)
+		require.Equal(t, codes.DataLoss, status.Code(err))
+		require.Equal(t, "failed to decode logs", status.Convert(err).Message())
+	})
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var promGuardrailRejectionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: promNamespace,
+	Name:      "search_rejections_total",
+	Help:      "The total number of trace searches rejected by the guardrails, by reason",
+}, []string{"reason"})
+
+// Guardrails limit trace searches, so that a single broad search cannot scan
+// the whole spans table. Zero values disable the limits.
+type Guardrails struct {
+	// MaxLookback is the longest time range a search may cover.
+	MaxLookback time.Duration
+
+	// DefaultLookback is the time range, ending now, that searches without a
+	// start time cover.
+	DefaultLookback time.Duration
+
+	// MaxNumTraces caps the number of traces a search returns. Searches
+	// asking for more, or not saying, get this many.
+	MaxNumTraces int
+
+	// MaxCost is the highest planner cost estimate of a search that is run.
+	MaxCost float64
+}
+
+// WithGuardrails makes the reader limit trace searches.
+func WithGuardrails(guardrails Guardrails) ReaderOption {
+	return func(r *Reader) {
+		r.guardrails = guardrails
+	}
+}
+
+// apply returns the query with the defaults applied, or an ErrInvalidQuery
+// error if it exceeds the limits.
+func (g Guardrails) apply(query *spanstore.TraceQueryParameters, now time.Time) (*spanstore.TraceQueryParameters, error) {
+	limited := *query
+
+	if g.DefaultLookback > 0 && limited.StartTimeMin.IsZero() {
+		end := limited.StartTimeMax
+		if end.IsZero() {
+			end = now
+		}
+
+		limited.StartTimeMin = end.Add(-g.DefaultLookback)
+	}
+
+	if g.MaxLookback > 0 {
+		if limited.StartTimeMin.IsZero() {
+			promGuardrailRejectionsCounter.WithLabelValues("no_start_time").Inc()
+			return nil, invalidQueryf("searches must have a start time, and may look back at most %s", g.MaxLookback)
+		}
+
+		end := limited.StartTimeMax
+		if end.IsZero() {
+			end = now
+		}
+
+		if lookback := end.Sub(limited.StartTimeMin); lookback > g.MaxLookback {
+			promGuardrailRejectionsCounter.WithLabelValues("lookback").Inc()
+			return nil, invalidQueryf("the search looks back %s, more than the maximum of %s; narrow the time range", lookback.Round(time.Second), g.MaxLookback)
+		}
+	}
+
+	if g.MaxNumTraces > 0 && (limited.NumTraces <= 0 || limited.NumTraces > g.MaxNumTraces) {
+		limited.NumTraces = g.MaxNumTraces
+	}
+
+	return &limited, nil
+}
+
+// checkCost returns an ErrInvalidQuery error if the cost estimate of a search
+// exceeds the limit.
+func (g Guardrails) checkCost(cost float64) error {
+	if g.MaxCost <= 0 || cost <= g.MaxCost {
+		return nil
+	}
+
+	promGuardrailRejectionsCounter.WithLabelValues("cost").Inc()
+	return invalidQueryf("the search is estimated to cost %.0f, more than the maximum of %.0f; narrow the time range or filter by service, operation or duration", cost, g.MaxCost)
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGuardrails(t *testing.T) {
+	now := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("should leave queries alone without guardrails", func(t *testing.T) {
+		query := &spanstore.TraceQueryParameters{ServiceName: "service", NumTraces: 5000}
+
+		limited, err := Guardrails{}.apply(query, now)
+		require.Nil(t, err)
+		require.Equal(t, query, limited)
+	})
+
+	t.Run("should apply the default lookback to queries without a start time", func(t *testing.T) {
+		g := Guardrails{DefaultLookback: time.Hour}
+
+		limited, err := g.apply(&spanstore.TraceQueryParameters{}, now)
+		require.Nil(t, err)
+		require.Equal(t, now.Add(-time.Hour), limited.StartTimeMin)
+		require.True(t, limited.StartTimeMax.IsZero())
+
+		end := now.Add(-24 * time.Hour)
+		limited, err = g.apply(&spanstore.TraceQueryParameters{StartTimeMax: end}, now)
+		require.Nil(t, err)
+		require.Equal(t, end.Add(-time.Hour), limited.StartTimeMin)
+	})
+
+	t.Run("should not change the query it is given", func(t *testing.T) {
+		query := &spanstore.TraceQueryParameters{}
+
+		_, err := Guardrails{DefaultLookback: time.Hour, MaxNumTraces: 10}.apply(query, now)
+		require.Nil(t, err)
+		require.True(t, query.StartTimeMin.IsZero())
+		require.Equal(t, 0, query.NumTraces)
+	})
+
+	t.Run("should reject queries looking back too far", func(t *testing.T) {
+		g := Guardrails{MaxLookback: 7 * 24 * time.Hour}
+
+		_, err := g.apply(&spanstore.TraceQueryParameters{StartTimeMin: now.Add(-8 * 24 * time.Hour)}, now)
+		require.ErrorIs(t, err, ErrInvalidQuery)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = g.apply(&spanstore.TraceQueryParameters{}, now)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = g.apply(&spanstore.TraceQueryParameters{
+			StartTimeMin: now.Add(-30 * 24 * time.Hour),
+			StartTimeMax: now.Add(-25 * 24 * time.Hour),
+		}, now)
+		require.Nil(t, err)
+	})
+
+	t.Run("should cap the number of traces", func(t *testing.T) {
+		g := Guardrails{MaxNumTraces: 100}
+
+		for _, tc := range []struct{ asked, got int }{{0, 100}, {20, 20}, {100, 100}, {5000, 100}} {
+			limited, err := g.apply(&spanstore.TraceQueryParameters{NumTraces: tc.asked}, now)
+			require.Nil(t, err)
+			require.Equal(t, tc.got, limited.NumTraces)
+		}
+	})
+
+	t.Run("should reject queries costing too much", func(t *testing.T) {
+		require.Nil(t, Guardrails{}.checkCost(1e9))
+		require.Nil(t, Guardrails{MaxCost: 1000}.checkCost(999))
+
+		err := Guardrails{MaxCost: 1000}.checkCost(1001)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "narrow the time range")
+	})
+}
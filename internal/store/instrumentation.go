@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
@@ -98,6 +99,12 @@ var (
 		Name:      "write_span_errors_total",
 		Help:      "The total number of errors returned from WriteSpan",
 	})
+
+	promWriteSpanPendingGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Name:      "write_span_pending",
+		Help:      "The number of spans being written, including those waiting for a database connection",
+	})
 )
 
 // NewInstrumentedWriter returns a new spanstore.Writer that is instrumented.
@@ -162,6 +169,10 @@ func (r *InstrumentedReader) GetTrace(ctx context.Context, traceID model.TraceID
 	}
 
 	trace, err := r.Reader.GetTrace(ctx, traceID)
+	if errors.Is(err, ErrTraceNotFound) {
+		// not an error of the storage, the trace may be unknown or expired
+		return nil, err
+	}
 	if err != nil {
 		promGetTraceErrorsCounter.Inc()
 		r.logger.Error("failed to get trace", "err", err)
@@ -199,13 +210,13 @@ func (r *InstrumentedReader) FindTraceIDs(ctx context.Context, query *spanstore.
 
 		start := time.Now()
 		defer func() {
-			promFindTraceIDsErrorsCounter.Inc()
 			promFindTraceIDsHistogram.Observe(time.Since(start).Seconds())
 		}()
 	}
 
 	traceIDs, err := r.Reader.FindTraceIDs(ctx, query)
 	if err != nil {
+		promFindTraceIDsErrorsCounter.Inc()
 		r.logger.Error("failed to retrieve trace ids", "err", err)
 		return nil, err
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
 	jaeger_integration_tests "github.com/jaegertracing/jaeger/plugin/storage/integration"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
@@ -80,3 +81,165 @@ func TestSpans(t *testing.T) {
 	require.Len(t, trace, 1)
 	require.Equal(t, span, trace[0].Spans[0])
 }
+
+func TestFindTraceIDs(t *testing.T) {
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	require.Nil(t, cleanup())
+
+	ctx := context.Background()
+
+	q := sql.New(conn)
+
+	logger := slog.Default()
+	w := NewWriter(q, logger)
+	r := NewReader(q, logger)
+
+	ts := TruncateTime(time.Now())
+
+	for i, env := range []string{"prod", "dev"} {
+		err := w.WriteSpan(ctx, &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(uint64(i + 1)),
+			OperationName: "operation",
+			StartTime:     ts,
+			Duration:      time.Duration(i+1) * time.Second,
+			Process:       model.NewProcess("service", []model.KeyValue{}),
+			Tags:          []model.KeyValue{model.String("env", env)},
+			References:    []model.SpanRef{},
+		})
+		require.Nil(t, err)
+	}
+
+	t.Run("should filter by tags", func(t *testing.T) {
+		traceIDs, err := r.FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+			ServiceName: "service",
+			Tags:        map[string]string{"env": "dev"},
+			NumTraces:   10,
+		})
+		require.Nil(t, err)
+		require.Equal(t, []model.TraceID{model.NewTraceID(0, 2)}, traceIDs)
+	})
+
+	t.Run("should filter by duration", func(t *testing.T) {
+		traceIDs, err := r.FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+			ServiceName: "service",
+			DurationMax: time.Second + time.Millisecond,
+			NumTraces:   10,
+		})
+		require.Nil(t, err)
+		require.Equal(t, []model.TraceID{model.NewTraceID(0, 1)}, traceIDs)
+	})
+}
+
+func TestOperationLimit(t *testing.T) {
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	require.Nil(t, cleanup())
+
+	ctx := context.Background()
+
+	q := sql.New(conn)
+
+	logger := slog.Default()
+	// the placeholder counts toward the limit
+	w := NewWriter(q, logger, WithOperationLimit(2, "<other>"))
+	r := NewReader(q, logger)
+
+	for i, operation := range []string{"first", "second", "first", "second"} {
+		err := w.WriteSpan(ctx, &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i)),
+			SpanID:        model.NewSpanID(uint64(i)),
+			OperationName: operation,
+			Process:       model.NewProcess("service", []model.KeyValue{}),
+			References:    []model.SpanRef{},
+		})
+		require.Nil(t, err)
+	}
+
+	operations, err := r.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "service"})
+	require.Nil(t, err)
+	require.Len(t, operations, 2)
+	require.Equal(t, "<other>", operations[0].Name)
+	require.Equal(t, "first", operations[1].Name)
+
+	trace, err := r.GetTrace(ctx, model.NewTraceID(0, 1))
+	require.Nil(t, err)
+	require.Equal(t, "<other>", trace.Spans[0].OperationName)
+	require.Equal(t, []model.KeyValue{model.String(OriginalOperationNameTag, "second")}, trace.Spans[0].Tags)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	require.Nil(t, cleanup())
+
+	q := sql.New(conn)
+
+	logger := slog.Default()
+	w := NewWriter(q, logger)
+	r := NewReader(q, logger)
+
+	acme := tenancy.WithTenant(context.Background(), "acme")
+	globex := tenancy.WithTenant(context.Background(), "globex")
+
+	err := w.WriteSpan(acme, &model.Span{
+		TraceID:       model.NewTraceID(0, 1),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "operation",
+		Process:       model.NewProcess("service", []model.KeyValue{}),
+		References:    []model.SpanRef{},
+	})
+	require.Nil(t, err)
+
+	services, err := r.GetServices(acme)
+	require.Nil(t, err)
+	require.Equal(t, []string{"service"}, services)
+
+	services, err = r.GetServices(globex)
+	require.Nil(t, err)
+	require.Empty(t, services)
+
+	_, err = r.GetTrace(acme, model.NewTraceID(0, 1))
+	require.Nil(t, err)
+
+	_, err = r.GetTrace(globex, model.NewTraceID(0, 1))
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	traceIDs, err := r.FindTraceIDs(globex, &spanstore.TraceQueryParameters{NumTraces: 10})
+	require.Nil(t, err)
+	require.Empty(t, traceIDs)
+}
+
+func TestCanary(t *testing.T) {
+	conn, cleanup, closer := sqltest.Harness(t)
+	defer closer.Close()
+
+	require.Nil(t, cleanup())
+
+	ctx := context.Background()
+
+	q := sql.New(conn)
+
+	logger := slog.Default()
+	w := NewWriter(q, logger, WithQuotas(NewQuotaEnforcer(QuotaConfig{Default: Quota{SpansPerDay: 1}}, logger)))
+	r := NewReader(q, logger)
+
+	canary := NewCanary(w, r, q, logger, time.Second*5)
+
+	// the quota allows a single span a day, which must not apply to the canary
+	for i := 0; i < 2; i++ {
+		require.Nil(t, canary.round(ctx))
+	}
+
+	services, err := r.GetServices(ctx)
+	require.Nil(t, err)
+	require.NotContains(t, services, CanaryServiceName)
+
+	spans, err := q.CleanServiceSpans(ctx, sql.CleanServiceSpansParams{ServiceName: CanaryServiceName})
+	require.Nil(t, err)
+	require.Zero(t, spans)
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/fieldcrypt"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
 
 	"github.com/jackc/pgx/v5/pgtype"
@@ -78,9 +79,19 @@ func encodeTagsToSlice(input []model.KeyValue) [][]any {
 type databaseTag struct {
 	sql.TagContent
 	Type model.ValueType
+
+	// Ciphertext holds the encrypted value of an encrypted tag, whose Value
+	// is then a blind index rather than the plaintext.
+	Ciphertext string `json:",omitempty"`
 }
 
 func EncodeTags(input []model.KeyValue) ([]byte, error) {
+	return encodeTags(input, nil)
+}
+
+// encodeTags encodes tags, encrypting the values of the tags that the cipher
+// encrypts. The cipher may be nil.
+func encodeTags(input []model.KeyValue, cipher *fieldcrypt.Cipher) ([]byte, error) {
 	tags := make([]databaseTag, 0, len(input))
 
 	for _, kv := range input {
@@ -101,6 +112,16 @@ func EncodeTags(input []model.KeyValue) ([]byte, error) {
 			tag.Value = base64.RawStdEncoding.EncodeToString(kv.VBinary)
 		}
 
+		if cipher != nil && cipher.Encrypts(kv.Key) {
+			ciphertext, err := cipher.Encrypt(kv.Key, tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt tag %s: %w", kv.Key, err)
+			}
+
+			tag.Ciphertext = ciphertext
+			tag.Value = cipher.BlindIndex(kv.Key, tag.Value)
+		}
+
 		tags = append(tags, tag)
 	}
 
@@ -166,7 +187,7 @@ func variableIsMap(variable interface{}) bool {
 	}
 }
 
-func decodeTagsFromStruct(objects []any) ([]model.KeyValue, error) {
+func decodeTagsFromStruct(objects []any, cipher *fieldcrypt.Cipher) ([]model.KeyValue, error) {
 	tags := make([]model.KeyValue, 0, len(objects))
 
 	for _, tag := range objects {
@@ -187,6 +208,19 @@ func decodeTagsFromStruct(objects []any) ([]model.KeyValue, error) {
 		value := preCastValue.(string)
 		valueType := model.ValueType(int(preCastValueType.(float64)))
 
+		if preCastCiphertext, ok := cast["Ciphertext"]; ok {
+			if cipher == nil {
+				return nil, fmt.Errorf("tag %s is encrypted but no keyfile is configured", key)
+			}
+
+			decrypted, err := cipher.Decrypt(key, preCastCiphertext.(string))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt tag %s: %w", key, err)
+			}
+
+			value = decrypted
+		}
+
 		kv := model.KeyValue{
 			Key:   key,
 			VType: valueType,
@@ -228,12 +262,18 @@ func decodeTagsFromStruct(objects []any) ([]model.KeyValue, error) {
 }
 
 func DecodeTags(input []byte) ([]model.KeyValue, error) {
+	return decodeTags(input, nil)
+}
+
+// decodeTags decodes tags, decrypting the values of encrypted tags. The
+// cipher may be nil as long as there are no encrypted tags.
+func decodeTags(input []byte, cipher *fieldcrypt.Cipher) ([]model.KeyValue, error) {
 	slice := []any{}
 	if err := json.Unmarshal(input, &slice); err != nil {
 		return nil, fmt.Errorf("failed to decode tag json: %w", err)
 	}
 
-	tags, err := decodeTagsFromStruct(slice)
+	tags, err := decodeTagsFromStruct(slice, cipher)
 	if err != nil {
 		return nil, err
 	}
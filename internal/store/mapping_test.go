@@ -1,8 +1,13 @@
 package store
 
 import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/fieldcrypt"
 	"github.com/jaegertracing/jaeger/model"
 
 	"github.com/stretchr/testify/require"
@@ -16,3 +21,27 @@ func TestToDomainTraceID(t *testing.T) {
 
 	require.Equal(t, decoded, traceID)
 }
+
+func TestEncryptedTags(t *testing.T) {
+	keyfile := filepath.Join(t.TempDir(), "keys.json")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	err := os.WriteFile(keyfile, []byte(`{"active": "k1", "keys": {"k1": "`+key+`"}, "index_key": "`+key+`"}`), 0o600)
+	require.Nil(t, err)
+
+	cipher, err := fieldcrypt.Load(keyfile, []string{"customer.id"})
+	require.Nil(t, err)
+
+	tags := []model.KeyValue{model.Int64("customer.id", 1234), model.String("http.method", "GET")}
+
+	encoded, err := encodeTags(tags, cipher)
+	require.Nil(t, err)
+	require.NotContains(t, string(encoded), "1234")
+	require.Contains(t, string(encoded), cipher.BlindIndex("customer.id", "1234"))
+
+	decoded, err := decodeTags(encoded, cipher)
+	require.Nil(t, err)
+	require.Equal(t, tags, decoded)
+
+	_, err = DecodeTags(encoded)
+	require.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errReadOnly      = status.Error(codes.FailedPrecondition, "jaeger-postgresql is running in read-only mode and does not accept spans")
+	errIngestionOnly = status.Error(codes.FailedPrecondition, "jaeger-postgresql is running in ingestion-only mode and does not serve queries")
+)
+
+var _ spanstore.Writer = ReadOnlyWriter{}
+
+// ReadOnlyWriter stands in for the writer in read-only mode, rejecting every
+// span with a FailedPrecondition error.
+type ReadOnlyWriter struct{}
+
+// WriteSpan rejects the span.
+func (ReadOnlyWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	return errReadOnly
+}
+
+var (
+	_ spanstore.Reader       = IngestionOnlyReader{}
+	_ dependencystore.Reader = IngestionOnlyReader{}
+)
+
+// IngestionOnlyReader stands in for the reader in ingestion-only mode,
+// rejecting every query with a FailedPrecondition error.
+type IngestionOnlyReader struct{}
+
+// GetServices rejects the query.
+func (IngestionOnlyReader) GetServices(ctx context.Context) ([]string, error) {
+	return nil, errIngestionOnly
+}
+
+// GetOperations rejects the query.
+func (IngestionOnlyReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return nil, errIngestionOnly
+}
+
+// GetTrace rejects the query.
+func (IngestionOnlyReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return nil, errIngestionOnly
+}
+
+// FindTraces rejects the query.
+func (IngestionOnlyReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return nil, errIngestionOnly
+}
+
+// FindTraceIDs rejects the query.
+func (IngestionOnlyReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return nil, errIngestionOnly
+}
+
+// GetDependencies rejects the query.
+func (IngestionOnlyReader) GetDependencies(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return nil, errIngestionOnly
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reject spans in read-only mode", func(t *testing.T) {
+		err := ReadOnlyWriter{}.WriteSpan(ctx, &model.Span{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("should reject queries in ingestion-only mode", func(t *testing.T) {
+		_, err := IngestionOnlyReader{}.GetServices(ctx)
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		_, err = IngestionOnlyReader{}.GetTrace(ctx, model.NewTraceID(0, 1))
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OriginalOperationNameTag is the span tag that holds the operation name of
+// a span whose operation was collapsed into the placeholder.
+const OriginalOperationNameTag = "original_operation_name"
+
+var (
+	promCollapsedOperationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "operations_collapsed_total",
+		Help:      "The total number of spans whose operation name was collapsed because the service has too many operations",
+	}, []string{"tenant", "service"})
+)
+
+// rejectedOperationsSize bounds the number of rejected operations remembered
+// per service.
+const rejectedOperationsSize = 1024
+
+type operationKey struct {
+	name string
+	kind sql.Spankind
+}
+
+// operationLRU is a set of operations that forgets the least recently used
+// ones beyond its size.
+type operationLRU struct {
+	size     int
+	order    *list.List
+	elements map[operationKey]*list.Element
+}
+
+func newOperationLRU(size int) *operationLRU {
+	return &operationLRU{size: size, order: list.New(), elements: map[operationKey]*list.Element{}}
+}
+
+// contains reports whether the key is in the set, marking it as used if so.
+func (l *operationLRU) contains(key operationKey) bool {
+	element, ok := l.elements[key]
+	if ok {
+		l.order.MoveToFront(element)
+	}
+
+	return ok
+}
+
+// add adds the key to the set, forgetting the least recently used key if the
+// set is full.
+func (l *operationLRU) add(key operationKey) {
+	if l.contains(key) {
+		return
+	}
+
+	l.elements[key] = l.order.PushFront(key)
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.elements, oldest.Value.(operationKey))
+	}
+}
+
+type serviceOperations struct {
+	// count is the number of operations of the service in the database,
+	// including the placeholder
+	count int64
+
+	// known caches operations that are known to exist in the database
+	known map[operationKey]struct{}
+
+	// rejected caches the latest operations that were collapsed, so that
+	// services with many operation names do not cost a query per span
+	rejected *operationLRU
+}
+
+// operationGuard caps the number of distinct operations per service, counting
+// the placeholder that spans beyond the cap are collapsed into. The cap is
+// checked against an in-memory count, so concurrent replicas may overshoot it
+// slightly, and an operation rejected by one replica stays collapsed on it
+// until it is forgotten, even if another replica stored it meanwhile.
+type operationGuard struct {
+	limit       int64
+	placeholder string
+
+	mu       sync.Mutex
+	services map[int64]*serviceOperations
+}
+
+// placeholderKey is the operation that spans beyond the cap are stored under,
+// whatever their kind, so that it takes a single operation of the cap.
+func (g *operationGuard) placeholderKey() operationKey {
+	return operationKey{name: g.placeholder, kind: sql.SpankindUnspecified}
+}
+
+// allow reports whether an operation may be stored under its own name.
+// Operations that already exist are always allowed; new operations are
+// allowed only while the service is below the limit, keeping room for the
+// placeholder until it exists.
+func (g *operationGuard) allow(ctx context.Context, q *sql.Queries, serviceID int64, key operationKey) (bool, error) {
+	g.mu.Lock()
+	ops, ok := g.services[serviceID]
+	if ok {
+		if _, known := ops.known[key]; known {
+			g.mu.Unlock()
+			return true, nil
+		}
+
+		if ops.rejected.contains(key) {
+			g.mu.Unlock()
+			return false, nil
+		}
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		var err error
+		ops, err = g.load(ctx, q, serviceID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	exists, err := operationExists(ctx, q, serviceID, key)
+	if err != nil {
+		return false, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !exists {
+		placeholder := g.placeholderKey()
+
+		reserved := int64(1)
+		if _, known := ops.known[placeholder]; known || key == placeholder {
+			reserved = 0
+		}
+
+		if ops.count+reserved >= g.limit {
+			ops.rejected.add(key)
+
+			// the writer stores the span under the placeholder
+			if _, known := ops.known[placeholder]; !known {
+				ops.known[placeholder] = struct{}{}
+				ops.count++
+			}
+
+			return false, nil
+		}
+
+		ops.count++
+	}
+
+	ops.known[key] = struct{}{}
+	return true, nil
+}
+
+// load returns the operations of the service, reading their count and whether
+// the placeholder exists from the database the first time.
+func (g *operationGuard) load(ctx context.Context, q *sql.Queries, serviceID int64) (*serviceOperations, error) {
+	count, err := q.CountServiceOperations(ctx, serviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count service operations: %w", err)
+	}
+
+	placeholder := g.placeholderKey()
+	placeholderExists, err := operationExists(ctx, q, serviceID, placeholder)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ops, ok := g.services[serviceID]
+	if !ok {
+		ops = &serviceOperations{
+			count:    count,
+			known:    map[operationKey]struct{}{},
+			rejected: newOperationLRU(rejectedOperationsSize),
+		}
+		if placeholderExists {
+			ops.known[placeholder] = struct{}{}
+		}
+
+		g.services[serviceID] = ops
+	}
+
+	return ops, nil
+}
+
+// operationExists reports whether the operation of the service is stored.
+func operationExists(ctx context.Context, q *sql.Queries, serviceID int64, key operationKey) (bool, error) {
+	_, err := q.GetOperationID(ctx, sql.GetOperationIDParams{
+		Name:      key.name,
+		ServiceID: serviceID,
+		Kind:      key.kind,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get operation id: %w", err)
+	}
+
+	return true, nil
+}
+
+// WithOperationLimit caps the number of distinct operations stored per
+// service, the placeholder included. Once a service reaches the limit, spans
+// with new operation names are stored under the placeholder name, of
+// unspecified kind, with the original name kept in the OriginalOperationNameTag
+// tag.
+func WithOperationLimit(limit int, placeholder string) WriterOption {
+	return func(w *Writer) {
+		w.operations = &operationGuard{
+			limit:       int64(limit),
+			placeholder: placeholder,
+			services:    map[int64]*serviceOperations{},
+		}
+	}
+}
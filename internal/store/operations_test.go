@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationLRU(t *testing.T) {
+	key := func(name string) operationKey {
+		return operationKey{name: name, kind: sql.SpankindServer}
+	}
+
+	t.Run("should forget the least recently used operations", func(t *testing.T) {
+		l := newOperationLRU(2)
+
+		l.add(key("first"))
+		l.add(key("second"))
+		require.True(t, l.contains(key("first")))
+
+		l.add(key("third"))
+		require.True(t, l.contains(key("first")))
+		require.False(t, l.contains(key("second")))
+		require.True(t, l.contains(key("third")))
+	})
+}
+
+func TestOperationGuard(t *testing.T) {
+	ctx := context.Background()
+
+	newGuard := func(ops *serviceOperations) *operationGuard {
+		return &operationGuard{
+			limit:       2,
+			placeholder: "<other>",
+			services:    map[int64]*serviceOperations{1: ops},
+		}
+	}
+
+	// the guard is given no database, so any of these queries would panic
+	var q *sql.Queries
+
+	t.Run("should allow known operations without a query", func(t *testing.T) {
+		g := newGuard(&serviceOperations{
+			count:    1,
+			known:    map[operationKey]struct{}{{name: "first", kind: sql.SpankindServer}: {}},
+			rejected: newOperationLRU(rejectedOperationsSize),
+		})
+
+		allowed, err := g.allow(ctx, q, 1, operationKey{name: "first", kind: sql.SpankindServer})
+		require.Nil(t, err)
+		require.True(t, allowed)
+	})
+
+	t.Run("should reject rejected operations without a query", func(t *testing.T) {
+		rejected := newOperationLRU(rejectedOperationsSize)
+		rejected.add(operationKey{name: "second", kind: sql.SpankindServer})
+
+		g := newGuard(&serviceOperations{count: 2, known: map[operationKey]struct{}{}, rejected: rejected})
+
+		for i := 0; i < 3; i++ {
+			allowed, err := g.allow(ctx, q, 1, operationKey{name: "second", kind: sql.SpankindServer})
+			require.Nil(t, err)
+			require.False(t, allowed)
+		}
+	})
+}
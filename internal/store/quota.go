@@ -0,0 +1,177 @@
+package store
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	dropReasonRate  = "rate"
+	dropReasonDaily = "daily"
+)
+
+var (
+	promDroppedSpansCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "spans_dropped_total",
+		Help:      "The total number of spans dropped because a service exceeded its quota",
+	}, []string{"tenant", "service", "reason"})
+)
+
+// Quota limits how many spans a service may write. Each tenant's service has
+// its own quota. A zero limit is unlimited.
+type Quota struct {
+	SpansPerSecond float64
+	SpansPerDay    int64
+}
+
+// QuotaConfig configures a QuotaEnforcer.
+type QuotaConfig struct {
+	// Default applies to every service without an entry in Services.
+	Default Quota
+
+	// Services holds per-service quotas keyed by service name, applying to the
+	// service of every tenant.
+	Services map[string]Quota
+
+	// WarnInterval is the minimum time between two warnings about the same
+	// service exceeding its quota.
+	WarnInterval time.Duration
+}
+
+func (c QuotaConfig) quota(service string) Quota {
+	if quota, ok := c.Services[service]; ok {
+		return quota
+	}
+
+	return c.Default
+}
+
+// quotaKey identifies the service of a tenant, so that tenants sending the
+// same service names do not share quotas.
+type quotaKey struct {
+	tenant  string
+	service string
+}
+
+type quotaState struct {
+	// token bucket for the per-second limit
+	tokens     float64
+	lastRefill time.Time
+
+	// spans accepted on the current day for the per-day limit
+	dayCount int64
+
+	lastWarning time.Time
+}
+
+// QuotaEnforcer decides whether a service is within its quota. Limits are
+// tracked in memory, so with several replicas each one enforces the limits
+// independently.
+//
+// The state of every service is dropped when the day rolls over, so that
+// clients sending ever new service names cannot grow it without bound. The
+// daily counts start over then anyway, and the token bucket of a service idle
+// for a second is full, so only services writing across midnight lose up to a
+// second of their rate limit.
+type QuotaEnforcer struct {
+	mu     sync.Mutex
+	cfg    QuotaConfig
+	day    time.Time
+	states map[quotaKey]*quotaState
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewQuotaEnforcer returns a new QuotaEnforcer.
+func NewQuotaEnforcer(cfg QuotaConfig, logger *slog.Logger) *QuotaEnforcer {
+	return &QuotaEnforcer{
+		cfg:    cfg,
+		states: map[quotaKey]*quotaState{},
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// SetConfig replaces the quotas. Usage counted so far is kept.
+func (e *QuotaEnforcer) SetConfig(cfg QuotaConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cfg = cfg
+}
+
+// Allow reports whether the service of the tenant may write one more span,
+// consuming quota if it may. When the span must be dropped the drop is counted and a warning
+// is logged at most once per WarnInterval.
+func (e *QuotaEnforcer) Allow(tenant, service string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	quota := e.cfg.quota(service)
+	if quota.SpansPerSecond <= 0 && quota.SpansPerDay <= 0 {
+		return true
+	}
+
+	now := e.now()
+	if today := day(now); !e.day.Equal(today) {
+		e.day = today
+		clear(e.states)
+	}
+
+	key := quotaKey{tenant: tenant, service: service}
+	state, ok := e.states[key]
+	if !ok {
+		state = &quotaState{tokens: burst(quota), lastRefill: now}
+		e.states[key] = state
+	}
+
+	if quota.SpansPerDay > 0 && state.dayCount >= quota.SpansPerDay {
+		e.drop(state, key, dropReasonDaily, now)
+		return false
+	}
+
+	if quota.SpansPerSecond > 0 {
+		elapsed := now.Sub(state.lastRefill).Seconds()
+		state.tokens = min(burst(quota), state.tokens+elapsed*quota.SpansPerSecond)
+		state.lastRefill = now
+
+		if state.tokens < 1 {
+			e.drop(state, key, dropReasonRate, now)
+			return false
+		}
+
+		state.tokens--
+	}
+
+	state.dayCount++
+	return true
+}
+
+func (e *QuotaEnforcer) drop(state *quotaState, key quotaKey, reason string, now time.Time) {
+	promDroppedSpansCounter.WithLabelValues(key.tenant, key.service, reason).Inc()
+
+	if now.Sub(state.lastWarning) < e.cfg.WarnInterval {
+		return
+	}
+
+	state.lastWarning = now
+	e.logger.Warn("dropping spans of service over quota", "tenant", key.tenant, "service", key.service, "reason", reason)
+}
+
+// burst is the size of the token bucket: one second worth of spans, but at
+// least one span so that fractional rates can make progress.
+func burst(quota Quota) float64 {
+	return max(quota.SpansPerSecond, 1)
+}
+
+// WithQuotas makes the writer drop spans of services that exceed their quota.
+func WithQuotas(enforcer *QuotaEnforcer) WriterOption {
+	return func(w *Writer) {
+		w.quotas = enforcer
+	}
+}
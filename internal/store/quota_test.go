@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaEnforcer(t *testing.T) {
+	now := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	newEnforcer := func(cfg QuotaConfig) *QuotaEnforcer {
+		e := NewQuotaEnforcer(cfg, slog.Default())
+		e.now = func() time.Time { return now }
+		return e
+	}
+
+	t.Run("should allow everything without quotas", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{})
+		for i := 0; i < 100; i++ {
+			require.True(t, e.Allow("", "service"))
+		}
+	})
+
+	t.Run("should limit spans per second", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{Default: Quota{SpansPerSecond: 2}})
+
+		require.True(t, e.Allow("", "service"))
+		require.True(t, e.Allow("", "service"))
+		require.False(t, e.Allow("", "service"))
+
+		now = now.Add(500 * time.Millisecond)
+		require.True(t, e.Allow("", "service"))
+		require.False(t, e.Allow("", "service"))
+	})
+
+	t.Run("should limit spans per day", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{Services: map[string]Quota{"noisy": {SpansPerDay: 2}}})
+
+		require.True(t, e.Allow("", "noisy"))
+		require.True(t, e.Allow("", "noisy"))
+		require.False(t, e.Allow("", "noisy"))
+		require.True(t, e.Allow("", "quiet"))
+
+		now = now.Add(24 * time.Hour)
+		require.True(t, e.Allow("", "noisy"))
+	})
+
+	t.Run("should forget services when the day rolls over", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{Default: Quota{SpansPerDay: 1}})
+
+		for i := 0; i < 100; i++ {
+			require.True(t, e.Allow("", fmt.Sprintf("service-%d", i)))
+		}
+		require.Len(t, e.states, 100)
+
+		now = now.Add(24 * time.Hour)
+		require.True(t, e.Allow("", "service-0"))
+		require.Len(t, e.states, 1)
+	})
+
+	t.Run("should keep the quotas of tenants apart", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{Default: Quota{SpansPerDay: 1}})
+
+		require.True(t, e.Allow("acme", "frontend"))
+		require.False(t, e.Allow("acme", "frontend"))
+		require.True(t, e.Allow("globex", "frontend"))
+	})
+
+	t.Run("should apply reloaded quotas", func(t *testing.T) {
+		e := newEnforcer(QuotaConfig{Default: Quota{SpansPerDay: 1}})
+
+		require.True(t, e.Allow("", "service"))
+		require.False(t, e.Allow("", "service"))
+
+		e.SetConfig(QuotaConfig{})
+		require.True(t, e.Allow("", "service"))
+	})
+}
+
+func TestWriterQuotas(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should enforce quotas on spans that claim to be the canary's", func(t *testing.T) {
+		quotas := NewQuotaEnforcer(QuotaConfig{Default: Quota{SpansPerDay: 1}}, slog.Default())
+		require.True(t, quotas.Allow("", CanaryServiceName))
+
+		// the writer has no database, so a span that is not dropped panics
+		w := NewWriter(nil, slog.Default(), WithQuotas(quotas))
+
+		err := w.WriteSpan(ctx, &model.Span{Process: model.NewProcess(CanaryServiceName, nil)})
+		require.Nil(t, err)
+	})
+}
@@ -6,9 +6,11 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/fieldcrypt"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
 
 	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
@@ -16,33 +18,82 @@ var _ spanstore.Reader = (*Reader)(nil)
 
 // Reader can query for and load traces from PostgreSQL v2.x.
 type Reader struct {
-	logger *slog.Logger
-	q      *sql.Queries
+	logger     *slog.Logger
+	q          *sql.Queries
+	cipher     *fieldcrypt.Cipher
+	guardrails Guardrails
 }
 
+// ReaderOption configures optional behaviour of a Reader.
+type ReaderOption func(*Reader)
+
 // NewReader returns a new SpanReader for PostgreSQL v2.x.
-func NewReader(q *sql.Queries, logger *slog.Logger) *Reader {
-	return &Reader{
+func NewReader(q *sql.Queries, logger *slog.Logger, opts ...ReaderOption) *Reader {
+	r := &Reader{
 		q:      q,
 		logger: logger,
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithReaderCipher makes the reader decrypt encrypted tags and search for
+// them by their blind index.
+func WithReaderCipher(cipher *fieldcrypt.Cipher) ReaderOption {
+	return func(r *Reader) {
+		r.cipher = cipher
+	}
+}
+
+// searchTags maps the tags of a search to the values they are stored as,
+// replacing the values of encrypted tags with their blind index.
+func (r *Reader) searchTags(tags map[string]string) map[string]string {
+	if r.cipher == nil || len(tags) == 0 {
+		return tags
+	}
+
+	mapped := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if r.cipher.Encrypts(key) {
+			value = r.cipher.BlindIndex(key, value)
+		}
+
+		mapped[key] = value
+	}
+
+	return mapped
 }
 
 // GetServices returns all services traced by Jaeger
 func (r *Reader) GetServices(ctx context.Context) ([]string, error) {
-	services, err := r.q.GetServices(ctx)
+	services, err := r.q.GetServices(ctx, tenancy.GetTenant(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classify(fmt.Errorf("failed to get services: %w", err))
+	}
+
+	// the canary is not traced by anyone, it only checks the storage
+	visible := services[:0]
+	for _, service := range services {
+		if service != CanaryServiceName {
+			visible = append(visible, service)
+		}
 	}
 
-	return services, nil
+	return visible, nil
 }
 
 // GetOperations returns all operations for a specific service traced by Jaeger
 func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
-	response, err := r.q.GetOperations(ctx, param.ServiceName)
+	response, err := r.q.GetOperations(ctx, sql.GetOperationsParams{
+		Tenant:      tenancy.GetTenant(ctx),
+		ServiceName: param.ServiceName,
+	})
 	if err != nil {
-		return nil, err
+		return nil, classify(fmt.Errorf("failed to get operations: %w", err))
 	}
 
 	var operations = make([]spanstore.Operation, len(response))
@@ -64,37 +115,40 @@ func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tr
 		}()
 	}
 
-	dbSpans, err := r.q.GetTraceSpans(ctx, EncodeTraceID(traceID))
+	dbSpans, err := r.q.GetTraceSpans(ctx, sql.GetTraceSpansParams{
+		Tenant:  tenancy.GetTenant(ctx),
+		TraceID: EncodeTraceID(traceID),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get trace spans: %w", err)
+		return nil, classify(fmt.Errorf("failed to get trace spans: %w", err))
 	}
 
 	if len(dbSpans) == 0 {
-		return nil, fmt.Errorf("trace not found")
+		return nil, ErrTraceNotFound
 	}
 
 	var spans []*model.Span = make([]*model.Span, len(dbSpans))
 	for i, dbSpan := range dbSpans {
-		tags, err := DecodeTags(dbSpan.Tags)
+		tags, err := decodeTags(dbSpan.Tags, r.cipher)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode span tags: %w", err)
+			return nil, corrupt(fmt.Errorf("failed to decode span tags: %w", err))
 		}
 
-		processTags, err := DecodeTags(dbSpan.ProcessTags)
+		processTags, err := decodeTags(dbSpan.ProcessTags, r.cipher)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode process tags: %w", err)
+			return nil, corrupt(fmt.Errorf("failed to decode process tags: %w", err))
 		}
 
 		duration := time.Duration(dbSpan.Duration.Microseconds * 1000)
 
 		logs, err := DecodeLogs(dbSpan.Logs)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode logs: %w", err)
+			return nil, corrupt(fmt.Errorf("failed to decode logs: %w", err))
 		}
 
 		decodedSpanRefs, err := DecodeSpanRefs(dbSpan.Refs)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode spanrefs: %w", err)
+			return nil, corrupt(fmt.Errorf("failed to decode spanrefs: %w", err))
 		}
 
 		spans[i] = &model.Span{
@@ -132,25 +186,9 @@ func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryPara
 		}()
 	}
 
-	response, err := r.q.FindTraceIDs(ctx, sql.FindTraceIDsParams{
-		ServiceName:                  query.ServiceName,
-		ServiceNameEnableFilter:      len(query.ServiceName) > 0,
-		OperationName:                query.OperationName,
-		OperationNameEnableFilter:    len(query.OperationName) > 0,
-		StartTimeMinimum:             EncodeTimestamp(query.StartTimeMin),
-		StartTimeMinimumEnableFilter: query.StartTimeMin.After(time.Time{}),
-		StartTimeMaximum:             EncodeTimestamp(query.StartTimeMax),
-		StartTimeMaximumEnableFilter: query.StartTimeMax.After(time.Time{}),
-		DurationMinimum:              EncodeInterval(query.DurationMin),
-		DurationMinimumEnableFilter:  query.DurationMin != time.Duration(0),
-		DurationMaximum:              EncodeInterval(query.DurationMax),
-		DurationMaximumEnableFilter:  query.DurationMax != time.Duration(0),
-		NumTraces:                    int32(query.NumTraces),
-		Tags:                         query.Tags,
-		TagsEnableFilter:             len(query.Tags) > 0,
-	})
+	response, err := r.findTraceIDs(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query trace ids: %w", err)
+		return nil, err
 	}
 
 	var traces []*model.Trace
@@ -177,7 +215,28 @@ func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryPa
 		}()
 	}
 
-	response, err := r.q.FindTraceIDs(ctx, sql.FindTraceIDsParams{
+	response, err := r.findTraceIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var traceIDs = make([]model.TraceID, len(response))
+	for i, iter := range response {
+		traceIDs[i] = DecodeTraceID(iter)
+	}
+
+	return traceIDs, nil
+}
+
+// findTraceIDs returns the ids of the traces that match the query, within the
+// guardrails.
+func (r *Reader) findTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([][]byte, error) {
+	query, err := r.guardrails.apply(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	params := sql.FindTraceIDsParams{
 		ServiceName:                  query.ServiceName,
 		ServiceNameEnableFilter:      len(query.ServiceName) > 0,
 		OperationName:                query.OperationName,
@@ -187,22 +246,32 @@ func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryPa
 		StartTimeMaximum:             EncodeTimestamp(query.StartTimeMax),
 		StartTimeMaximumEnableFilter: query.StartTimeMax.After(time.Time{}),
 		DurationMinimum:              EncodeInterval(query.DurationMin),
-		DurationMinimumEnableFilter:  query.DurationMin > 0*time.Second,
+		DurationMinimumEnableFilter:  query.DurationMin > 0,
 		DurationMaximum:              EncodeInterval(query.DurationMax),
-		DurationMaximumEnableFilter:  query.DurationMax > 0*time.Second,
-		Tags:                         query.Tags,
+		DurationMaximumEnableFilter:  query.DurationMax > 0,
 		NumTraces:                    int32(query.NumTraces),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to query trace ids: %w", err)
+		Tags:                         r.searchTags(query.Tags),
+		Tenant:                       tenancy.GetTenant(ctx),
+		TagsEnableFilter:             len(query.Tags) > 0,
 	}
 
-	var traceIDs = make([]model.TraceID, len(response))
-	for i, iter := range response {
-		traceIDs[i] = DecodeTraceID(iter)
+	if r.guardrails.MaxCost > 0 {
+		cost, err := r.q.EstimateFindTraceIDsCost(ctx, params)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to estimate search cost: %w", err))
+		}
+
+		if err := r.guardrails.checkCost(cost); err != nil {
+			return nil, err
+		}
 	}
 
-	return traceIDs, nil
+	response, err := r.q.FindTraceIDs(ctx, params)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to query trace ids: %w", err))
+	}
+
+	return response, nil
 }
 
 // GetDependencies returns all inter-service dependencies
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/selftrace"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// endSpan records the error, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// NewTracingWriter returns a new spanstore.Writer that traces its writes.
+// Spans of selfServiceName are written without being traced, as they are the
+// self traces themselves.
+func NewTracingWriter(embedded spanstore.Writer, provider trace.TracerProvider, selfServiceName string) *TracingWriter {
+	return &TracingWriter{Writer: embedded, tracer: selftrace.Tracer(provider), selfServiceName: selfServiceName}
+}
+
+// TracingWriter is a writer that traces its writes.
+type TracingWriter struct {
+	spanstore.Writer
+	tracer          trace.Tracer
+	selfServiceName string
+}
+
+func (w *TracingWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	// tracing the write of a self trace would export another self trace to
+	// be written, without end
+	if span.Process.ServiceName == w.selfServiceName {
+		return w.Writer.WriteSpan(selftrace.Suppress(ctx), span)
+	}
+
+	ctx, s := w.tracer.Start(ctx, "WriteSpan", trace.WithAttributes(
+		attribute.String("jaeger.service", span.Process.ServiceName),
+		attribute.String("jaeger.trace_id", span.TraceID.String()),
+	))
+
+	err := w.Writer.WriteSpan(ctx, span)
+	endSpan(s, err)
+	return err
+}
+
+// NewTracingReader returns a new spanstore.Reader that traces its reads.
+func NewTracingReader(embedded spanstore.Reader, provider trace.TracerProvider) *TracingReader {
+	return &TracingReader{Reader: embedded, tracer: selftrace.Tracer(provider)}
+}
+
+// TracingReader is a reader that traces its reads.
+type TracingReader struct {
+	spanstore.Reader
+	tracer trace.Tracer
+}
+
+// queryAttributes returns the attributes of a trace query.
+func queryAttributes(query *spanstore.TraceQueryParameters) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("jaeger.service", query.ServiceName),
+		attribute.String("jaeger.operation", query.OperationName),
+		attribute.Int("jaeger.tags", len(query.Tags)),
+		attribute.String("jaeger.lookback", query.StartTimeMax.Sub(query.StartTimeMin).Round(time.Second).String()),
+		attribute.Int("jaeger.num_traces", query.NumTraces),
+	}
+}
+
+func (r *TracingReader) GetServices(ctx context.Context) ([]string, error) {
+	ctx, s := r.tracer.Start(ctx, "GetServices")
+
+	services, err := r.Reader.GetServices(ctx)
+	endSpan(s, err)
+	return services, err
+}
+
+func (r *TracingReader) GetOperations(ctx context.Context, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	ctx, s := r.tracer.Start(ctx, "GetOperations", trace.WithAttributes(
+		attribute.String("jaeger.service", query.ServiceName),
+	))
+
+	operations, err := r.Reader.GetOperations(ctx, query)
+	endSpan(s, err)
+	return operations, err
+}
+
+func (r *TracingReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	ctx, s := r.tracer.Start(ctx, "GetTrace", trace.WithAttributes(
+		attribute.String("jaeger.trace_id", traceID.String()),
+	))
+
+	t, err := r.Reader.GetTrace(ctx, traceID)
+	if err == nil {
+		s.SetAttributes(attribute.Int("jaeger.spans", len(t.Spans)))
+	}
+
+	endSpan(s, err)
+	return t, err
+}
+
+func (r *TracingReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	ctx, s := r.tracer.Start(ctx, "FindTraces", trace.WithAttributes(queryAttributes(query)...))
+
+	traces, err := r.Reader.FindTraces(ctx, query)
+	if err == nil {
+		s.SetAttributes(attribute.Int("jaeger.traces", len(traces)))
+	}
+
+	endSpan(s, err)
+	return traces, err
+}
+
+func (r *TracingReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	ctx, s := r.tracer.Start(ctx, "FindTraceIDs", trace.WithAttributes(queryAttributes(query)...))
+
+	traceIDs, err := r.Reader.FindTraceIDs(ctx, query)
+	if err == nil {
+		s.SetAttributes(attribute.Int("jaeger.traces", len(traceIDs)))
+	}
+
+	endSpan(s, err)
+	return traceIDs, err
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/selftrace"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// suppressionWriter records whether tracing was suppressed for each write.
+type suppressionWriter struct {
+	spanstore.Writer
+	suppressed []bool
+}
+
+func (w *suppressionWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	w.suppressed = append(w.suppressed, selftrace.Suppressed(ctx))
+	return nil
+}
+
+func TestTracingWriter(t *testing.T) {
+	ctx := context.Background()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	embedded := &suppressionWriter{}
+	w := NewTracingWriter(embedded, provider, selftrace.DefaultServiceName)
+
+	t.Run("should trace writes", func(t *testing.T) {
+		err := w.WriteSpan(ctx, &model.Span{Process: model.NewProcess("service", nil)})
+		require.Nil(t, err)
+
+		require.Len(t, recorder.Ended(), 1)
+		require.Equal(t, "WriteSpan", recorder.Ended()[0].Name())
+		require.Equal(t, []bool{false}, embedded.suppressed)
+	})
+
+	t.Run("should not trace writes of self traces", func(t *testing.T) {
+		err := w.WriteSpan(ctx, &model.Span{Process: model.NewProcess(selftrace.DefaultServiceName, nil)})
+		require.Nil(t, err)
+
+		require.Len(t, recorder.Ended(), 1)
+		require.Equal(t, []bool{false, true}, embedded.suppressed)
+	})
+}
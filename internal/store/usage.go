@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	promServiceSpansCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "service_spans_written_total",
+		Help:      "The total number of spans written per tenant and service",
+	}, []string{"tenant", "service"})
+
+	promServiceBytesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Name:      "service_bytes_written_total",
+		Help:      "The approximate number of encoded bytes written per tenant and service",
+	}, []string{"tenant", "service"})
+)
+
+type usageKey struct {
+	day       time.Time
+	serviceID int64
+}
+
+type usage struct {
+	spans int64
+	bytes int64
+}
+
+// usageTracker accumulates per-service usage in memory until it is flushed to
+// the service_usage_daily table.
+type usageTracker struct {
+	mu      sync.Mutex
+	pending map[usageKey]usage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{pending: map[usageKey]usage{}}
+}
+
+func (t *usageTracker) record(now time.Time, serviceID int64, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := usageKey{day: day(now), serviceID: serviceID}
+	u := t.pending[key]
+	u.spans++
+	u.bytes += bytes
+	t.pending[key] = u
+}
+
+func (t *usageTracker) take() map[usageKey]usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending
+	t.pending = map[usageKey]usage{}
+	return pending
+}
+
+// restore adds usage that failed to flush back into the pending set so that
+// it is retried on the next flush.
+func (t *usageTracker) restore(failed map[usageKey]usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, f := range failed {
+		u := t.pending[key]
+		u.spans += f.spans
+		u.bytes += f.bytes
+		t.pending[key] = u
+	}
+}
+
+// day truncates a time to midnight UTC.
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// encodedSize approximates the number of bytes a span occupies in the spans
+// table.
+func encodedSize(params sql.InsertSpanParams) int64 {
+	size := len(params.SpanID) + len(params.TraceID) + len(params.ProcessID) +
+		len(params.Tags) + len(params.ProcessTags) + len(params.Logs) + len(params.Refs)
+	for _, warning := range params.Warnings {
+		size += len(warning)
+	}
+
+	// operation_id, service_id, flags, start_time and duration
+	size += 8 * 5
+
+	return int64(size)
+}
+
+// WithUsageTracking makes the writer accumulate per-service usage so that it
+// can be persisted with FlushUsage.
+func WithUsageTracking() WriterOption {
+	return func(w *Writer) {
+		w.usage = newUsageTracker()
+	}
+}
+
+// FlushUsage adds the usage accumulated since the last flush to the
+// service_usage_daily table. Usage that could not be written is kept and
+// retried on the next flush.
+func (w *Writer) FlushUsage(ctx context.Context) error {
+	if w.usage == nil {
+		return nil
+	}
+
+	pending := w.usage.take()
+	failed := map[usageKey]usage{}
+
+	var firstErr error
+	for key, u := range pending {
+		err := w.q.UpsertServiceUsage(ctx, sql.UpsertServiceUsageParams{
+			Day:       pgtype.Date{Time: key.day, Valid: true},
+			ServiceID: key.serviceID,
+			Spans:     u.spans,
+			Bytes:     u.bytes,
+		})
+		if err != nil {
+			failed[key] = u
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		w.usage.restore(failed)
+		return fmt.Errorf("failed to flush usage for %d services: %w", len(failed), firstErr)
+	}
+
+	return nil
+}
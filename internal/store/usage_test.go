@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageTracker(t *testing.T) {
+	t.Run("should accumulate usage per service and day", func(t *testing.T) {
+		tracker := newUsageTracker()
+
+		morning := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+		tracker.record(morning, 1, 100)
+		tracker.record(morning.Add(time.Hour), 1, 50)
+		tracker.record(morning, 2, 10)
+		tracker.record(morning.Add(24*time.Hour), 1, 1)
+
+		pending := tracker.take()
+		require.Equal(t, map[usageKey]usage{
+			{day: day(morning), serviceID: 1}:                     {spans: 2, bytes: 150},
+			{day: day(morning), serviceID: 2}:                     {spans: 1, bytes: 10},
+			{day: day(morning.Add(24 * time.Hour)), serviceID: 1}: {spans: 1, bytes: 1},
+		}, pending)
+
+		require.Empty(t, tracker.take())
+	})
+
+	t.Run("should merge restored usage with new usage", func(t *testing.T) {
+		tracker := newUsageTracker()
+
+		now := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+		tracker.record(now, 1, 100)
+
+		failed := tracker.take()
+		tracker.record(now, 1, 20)
+		tracker.restore(failed)
+
+		require.Equal(t, map[usageKey]usage{
+			{day: day(now), serviceID: 1}: {spans: 2, bytes: 120},
+		}, tracker.take())
+	})
+}
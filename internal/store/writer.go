@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
+	"github.com/Guy-Adler/jaeger-postgresql/internal/fieldcrypt"
+	"github.com/Guy-Adler/jaeger-postgresql/internal/redact"
 	"github.com/Guy-Adler/jaeger-postgresql/internal/sql"
 
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
@@ -21,31 +26,95 @@ var _ io.Closer = (*Writer)(nil)
 type Writer struct {
 	q      *sql.Queries
 	logger *slog.Logger
+	usage  *usageTracker
+	quotas *QuotaEnforcer
+
+	operations *operationGuard
+	redactor   *redact.Redactor
+	cipher     *fieldcrypt.Cipher
+
+	pending atomic.Int64
 }
 
+// WriterOption configures optional behaviour of a Writer.
+type WriterOption func(*Writer)
+
 // NewWriter returns a Writer.
-func NewWriter(q *sql.Queries, logger *slog.Logger) *Writer {
+func NewWriter(q *sql.Queries, logger *slog.Logger, opts ...WriterOption) *Writer {
 	w := &Writer{
 		q:      q,
 		logger: logger,
 	}
 
+	for _, opt := range opts {
+		opt(w)
+	}
+
 	return w
 }
 
+// WithRedactor makes the writer redact tags, log fields and process tags
+// before they are stored.
+func WithRedactor(redactor *redact.Redactor) WriterOption {
+	return func(w *Writer) {
+		w.redactor = redactor
+	}
+}
+
+// WithWriterCipher makes the writer encrypt the values of the tags and process
+// tags that the cipher encrypts.
+func WithWriterCipher(cipher *fieldcrypt.Cipher) WriterOption {
+	return func(w *Writer) {
+		w.cipher = cipher
+	}
+}
+
 // Close triggers a graceful shutdown
 func (w *Writer) Close() error {
 	return nil
 }
 
+// Pending returns the number of spans being written. The writer has no queue
+// of its own; writes beyond the pool size wait for a connection, so this is
+// how far behind the database is.
+func (w *Writer) Pending() int64 {
+	return w.pending.Load()
+}
+
 // WriteSpan saves the span into PostgreSQL
 func (w *Writer) WriteSpan(ctx context.Context, span *model.Span) error {
-	err := w.q.UpsertService(ctx, span.Process.ServiceName)
+	w.pending.Add(1)
+	promWriteSpanPendingGauge.Inc()
+	defer func() {
+		w.pending.Add(-1)
+		promWriteSpanPendingGauge.Dec()
+	}()
+
+	return classify(w.writeSpan(ctx, span))
+}
+
+// writeSpan saves the span into PostgreSQL, once it is counted as pending
+func (w *Writer) writeSpan(ctx context.Context, span *model.Span) error {
+	tenant := tenancy.GetTenant(ctx)
+
+	// dropping canary spans would fail the canary rather than protect the
+	// database
+	if w.quotas != nil && !isCanary(ctx) && !w.quotas.Allow(tenant, span.Process.ServiceName) {
+		return nil
+	}
+
+	err := w.q.UpsertService(ctx, sql.UpsertServiceParams{
+		Tenant: tenant,
+		Name:   span.Process.ServiceName,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to upsert span service: %w", err)
 	}
 
-	serviceID, err := w.q.GetServiceID(ctx, span.Process.ServiceName)
+	serviceID, err := w.q.GetServiceID(ctx, sql.GetServiceIDParams{
+		Tenant: tenant,
+		Name:   span.Process.ServiceName,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to get service id: %w", err)
 	}
@@ -55,35 +124,67 @@ func (w *Writer) WriteSpan(ctx context.Context, span *model.Span) error {
 		modelKind = trace.SpanKindUnspecified
 	}
 
+	operationName := span.OperationName
+	operationKind := EncodeSpanKind(modelKind)
+	spanTags := span.Tags
+	if w.operations != nil {
+		allowed, err := w.operations.allow(ctx, w.q, serviceID, operationKey{name: operationName, kind: operationKind})
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			promCollapsedOperationsCounter.WithLabelValues(tenant, span.Process.ServiceName).Inc()
+
+			placeholder := w.operations.placeholderKey()
+			operationName, operationKind = placeholder.name, placeholder.kind
+
+			// copy the tags rather than appending to them, the span belongs
+			// to the caller
+			spanTags = make([]model.KeyValue, 0, len(span.Tags)+1)
+			spanTags = append(spanTags, span.Tags...)
+			spanTags = append(spanTags, model.String(OriginalOperationNameTag, span.OperationName))
+		}
+	}
+
 	err = w.q.UpsertOperation(ctx, sql.UpsertOperationParams{
-		Name:      span.OperationName,
+		Name:      operationName,
 		ServiceID: serviceID,
-		Kind:      EncodeSpanKind(modelKind),
+		Kind:      operationKind,
+		Tenant:    tenant,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to upsert span operation: %w", err)
 	}
 
 	operationID, err := w.q.GetOperationID(ctx, sql.GetOperationIDParams{
-		Name:      span.OperationName,
+		Name:      operationName,
 		ServiceID: serviceID,
-		Kind:      EncodeSpanKind(modelKind),
+		Kind:      operationKind,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get operation id: %w", err)
 	}
 
-	logs, err := EncodeLogs(span.Logs)
+	spanLogs := span.Logs
+	spanProcessTags := span.Process.Tags
+	if w.redactor != nil {
+		spanTags = w.redactor.RedactTags(spanTags)
+		spanLogs = w.redactor.RedactLogs(spanLogs)
+		spanProcessTags = w.redactor.RedactTags(spanProcessTags)
+	}
+
+	logs, err := EncodeLogs(spanLogs)
 	if err != nil {
 		return fmt.Errorf("failed to encode logs: %w", err)
 	}
 
-	tags, err := EncodeTags(span.Tags)
+	tags, err := encodeTags(spanTags, w.cipher)
 	if err != nil {
 		return fmt.Errorf("failed to encode tags: %w", err)
 	}
 
-	processTags, err := EncodeTags(span.Process.Tags)
+	processTags, err := encodeTags(spanProcessTags, w.cipher)
 	if err != nil {
 		return fmt.Errorf("failed to encode process tags: %w", err)
 	}
@@ -93,7 +194,7 @@ func (w *Writer) WriteSpan(ctx context.Context, span *model.Span) error {
 		return fmt.Errorf("failed to encode spanrefs: %w", err)
 	}
 
-	_, err = w.q.InsertSpan(ctx, sql.InsertSpanParams{
+	params := sql.InsertSpanParams{
 		SpanID:      EncodeSpanID(span.SpanID),
 		TraceID:     EncodeTraceID(span.TraceID),
 		OperationID: operationID,
@@ -108,10 +209,21 @@ func (w *Writer) WriteSpan(ctx context.Context, span *model.Span) error {
 		Kind:        EncodeSpanKind(modelKind),
 		Logs:        logs,
 		Refs:        encodedSpanRefs,
-	})
+		Tenant:      tenant,
+	}
+
+	_, err = w.q.InsertSpan(ctx, params)
 	if err != nil {
 		return fmt.Errorf("failed to insert span: %w", err)
 	}
 
+	size := encodedSize(params)
+	promServiceSpansCounter.WithLabelValues(tenant, span.Process.ServiceName).Inc()
+	promServiceBytesCounter.WithLabelValues(tenant, span.Process.ServiceName).Add(float64(size))
+
+	if w.usage != nil {
+		w.usage.record(time.Now(), serviceID, size)
+	}
+
 	return nil
 }
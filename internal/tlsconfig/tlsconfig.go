@@ -0,0 +1,220 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often the files are checked for changes when
+// no interval is configured.
+const DefaultReloadInterval = time.Minute
+
+// Config configures TLS for a server.
+type Config struct {
+	// CertFile and KeyFile hold the PEM encoded server certificate and key.
+	// TLS is enabled when CertFile is set.
+	CertFile string `mapstructure:"cert"`
+	KeyFile  string `mapstructure:"key"`
+
+	// ClientCAFile holds the PEM encoded CAs that client certificates must be
+	// signed by. When set, clients must present a certificate (mutual TLS).
+	ClientCAFile string `mapstructure:"client-ca"`
+
+	// MinVersion is the minimum TLS version, e.g. "1.2" or "1.3".
+	MinVersion string `mapstructure:"min-version"`
+
+	// ReloadInterval is how often the files are checked for changes, so that
+	// renewed certificates are picked up without a restart.
+	ReloadInterval time.Duration `mapstructure:"reload-interval"`
+}
+
+// Enabled reports whether TLS is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Reloader serves the certificates from the configured files, reloading them
+// when they change.
+type Reloader struct {
+	cfg        Config
+	minVersion uint16
+	logger     *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader loads the files of the config, failing if they are invalid.
+func NewReloader(cfg Config, logger *slog.Logger) (*Reloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("both a certificate and a key are required for tls")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		var ok bool
+		if minVersion, ok = versions[cfg.MinVersion]; !ok {
+			return nil, fmt.Errorf("invalid tls min version: %q", cfg.MinVersion)
+		}
+	}
+
+	r := &Reloader{
+		cfg:        cfg,
+		minVersion: minVersion,
+		logger:     logger,
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns a server tls config that always uses the latest loaded
+// certificates. The certificates are looked up per handshake rather than set
+// on the config, so the config stays valid when servers clone it.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: r.minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return r.cert, nil
+		},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		// the client certificate is verified against the latest client CAs
+		// below, instead of the fixed ClientCAs of the config
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyConnection = r.verifyClient
+	}
+
+	return config
+}
+
+// verifyClient verifies the client certificate against the client CAs.
+func (r *Reloader) verifyClient(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("client certificate required")
+	}
+
+	r.mu.RLock()
+	clientCAs := r.clientCAs
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	return nil
+}
+
+// Run checks the files for changes until the context is done. A change that
+// fails to load is logged and the previous certificates are kept.
+func (r *Reloader) Run(ctx context.Context) {
+	interval := r.cfg.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Error("failed to reload tls certificates", "err", err)
+				continue
+			}
+
+			if reloaded {
+				r.logger.Info("reloaded tls certificates", "cert", r.cfg.CertFile)
+			}
+		}
+	}
+}
+
+// reload loads the files if any of them changed since they were last loaded,
+// returning whether they were.
+func (r *Reloader) reload() (bool, error) {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	changed := false
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read client ca: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in client ca %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self signed certificate with the serial number and its
+// key to the files.
+func writeCert(t *testing.T, serial int64, certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "jaeger-postgresql"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func serial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+
+	cert, err := r.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	require.Nil(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.Nil(t, err)
+
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	t.Run("should reject an invalid min version", func(t *testing.T) {
+		writeCert(t, 1, certFile, keyFile)
+
+		_, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.4"}, slog.Default())
+		require.NotNil(t, err)
+	})
+
+	t.Run("should reload a changed certificate", func(t *testing.T) {
+		writeCert(t, 1, certFile, keyFile)
+
+		r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile}, slog.Default())
+		require.Nil(t, err)
+		require.Equal(t, int64(1), serial(t, r))
+
+		reloaded, err := r.reload()
+		require.Nil(t, err)
+		require.False(t, reloaded)
+
+		writeCert(t, 2, certFile, keyFile)
+		later := time.Now().Add(time.Minute)
+		require.Nil(t, os.Chtimes(certFile, later, later))
+
+		reloaded, err = r.reload()
+		require.Nil(t, err)
+		require.True(t, reloaded)
+		require.Equal(t, int64(2), serial(t, r))
+	})
+
+	t.Run("should verify client certificates against the client ca", func(t *testing.T) {
+		writeCert(t, 1, certFile, keyFile)
+
+		r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, MinVersion: "1.3"}, slog.Default())
+		require.Nil(t, err)
+
+		config := r.TLSConfig()
+		require.Equal(t, tls.RequireAnyClientCert, config.ClientAuth)
+		require.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+
+		require.NotNil(t, config.VerifyConnection(tls.ConnectionState{}))
+
+		trusted, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.Nil(t, err)
+
+		trustedLeaf, err := x509.ParseCertificate(trusted.Certificate[0])
+		require.Nil(t, err)
+
+		require.Nil(t, config.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{trustedLeaf}}))
+
+		otherCertFile := filepath.Join(dir, "other.crt")
+		otherKeyFile := filepath.Join(dir, "other.key")
+		writeCert(t, 3, otherCertFile, otherKeyFile)
+
+		other, err := tls.LoadX509KeyPair(otherCertFile, otherKeyFile)
+		require.Nil(t, err)
+
+		otherLeaf, err := x509.ParseCertificate(other.Certificate[0])
+		require.Nil(t, err)
+
+		require.NotNil(t, config.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{otherLeaf}}))
+	})
+}